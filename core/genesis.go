@@ -0,0 +1,149 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/rawdb"
+	"hyblockchain/statdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/hexutil"
+	"hyblockchain/utils/math"
+)
+
+var (
+	// ErrGenesisMismatch 表示数据库是用另一份创世配置创建的
+	ErrGenesisMismatch = errors.New("genesis: database was created with a different genesis")
+	// ErrBalanceTooLarge 表示创世余额超出账户余额的范围
+	ErrBalanceTooLarge = errors.New("genesis: balance does not fit in uint64")
+)
+
+// Genesis 描述创世区块和初始账户，对应 genesis.json：
+//
+//	{
+//	  "timestamp": "0x0",
+//	  "coinbase": "0x0000000000000000000000000000000000000000",
+//	  "alloc": {
+//	    "0x0100000000000000000000000000000000000000": {
+//	      "balance": "1000000",
+//	      "nonce": "0x1",
+//	      "code": "0x6060",
+//	      "storage": {"0x00...01": "0x00...02"}
+//	    }
+//	  }
+//	}
+type Genesis struct {
+	Timestamp math.HexOrDecimal64 `json:"timestamp"`
+	Coinbase  types.Address       `json:"coinbase"`
+	Alloc     GenesisAlloc        `json:"alloc"`
+}
+
+// GenesisAlloc 是创世区块中的初始账户
+type GenesisAlloc map[types.Address]GenesisAccount
+
+// GenesisAccount 是一个初始账户
+type GenesisAccount struct {
+	Balance *math.HexOrDecimal256   `json:"balance"`
+	Nonce   math.HexOrDecimal64     `json:"nonce,omitempty"`
+	Code    hexutil.Bytes           `json:"code,omitempty"`
+	Storage map[hash.Hash]hash.Hash `json:"storage,omitempty"`
+}
+
+// ReadGenesis 从 JSON 文件读取创世配置
+func ReadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("genesis: invalid %s: %w", path, err)
+	}
+	return genesis, nil
+}
+
+// Commit 把初始账户写入 db 中的状态并提交，返回状态根
+func (g *Genesis) Commit(db kvstore.KVStore) (hash.Hash, error) {
+	state, err := statdb.NewStateDB(db, hash.Hash{})
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	for addr, account := range g.Alloc {
+		balance := (*big.Int)(account.Balance)
+		if balance == nil {
+			balance = new(big.Int)
+		}
+		if !balance.IsUint64() {
+			return hash.Hash{}, fmt.Errorf("%w: account %x has %s", ErrBalanceTooLarge, addr, balance)
+		}
+		if err := state.AddBalance(addr, balance.Uint64()); err != nil {
+			return hash.Hash{}, err
+		}
+		state.SetNonce(addr, uint64(account.Nonce))
+		if len(account.Code) > 0 {
+			state.SetCode(addr, account.Code)
+		}
+		for key, value := range account.Storage {
+			state.SetState(addr, key, value)
+		}
+	}
+	return state.Commit()
+}
+
+// ToBlock 返回状态根为 root 的创世区块
+func (g *Genesis) ToBlock(root hash.Hash) *types.Block {
+	return &types.Block{
+		Header: &types.Header{
+			Height:    0,
+			Coinbase:  g.Coinbase,
+			Root:      root,
+			Timestamp: uint64(g.Timestamp),
+		},
+		Body: &types.Body{},
+	}
+}
+
+// SetupGenesis 把创世配置写入 db 并返回创世状态根。数据库已经有创世区块时
+// 只在内存中计算新的创世区块并检查两者是否一致，不一致时返回 ErrGenesisMismatch，
+// 此时不会写入 db
+func SetupGenesis(db kvstore.KVStore, g *Genesis) (hash.Hash, error) {
+	stored, err := rawdb.ReadCanonicalHash(db, 0)
+	if err == nil {
+		root, err := g.Commit(memorydb.NewMemoryDB())
+		if err != nil {
+			return hash.Hash{}, err
+		}
+		if block := g.ToBlock(root); stored != block.Hash() {
+			return hash.Hash{}, fmt.Errorf("%w: have %x, new %x", ErrGenesisMismatch, stored, block.Hash())
+		}
+		return root, nil
+	}
+	if !errors.Is(err, kvstore.ErrNotFound) {
+		return hash.Hash{}, err
+	}
+
+	root, err := g.Commit(db)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	block := g.ToBlock(root)
+	if err := rawdb.WriteBlock(db, block); err != nil {
+		return hash.Hash{}, err
+	}
+	if err := rawdb.WriteCanonicalHash(db, block.Hash(), 0); err != nil {
+		return hash.Hash{}, err
+	}
+	if err := rawdb.WriteHeadHeaderHash(db, block.Hash()); err != nil {
+		return hash.Hash{}, err
+	}
+	if err := rawdb.WriteHeadBlockHash(db, block.Hash()); err != nil {
+		return hash.Hash{}, err
+	}
+	return root, nil
+}
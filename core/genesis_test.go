@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/statdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+const testGenesis = `{
+  "timestamp": "0x10",
+  "alloc": {
+    "0x0100000000000000000000000000000000000000": {"balance": "1000000", "nonce": "0x2"},
+    "0x0200000000000000000000000000000000000000": {
+      "balance": "0xff",
+      "code": "0x60606040",
+      "storage": {
+        "0x0000000000000000000000000000000000000000000000000000000000000001": "0x0000000000000000000000000000000000000000000000000000000000000002"
+      }
+    }
+  }
+}`
+
+func writeGenesis(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	return path
+}
+
+// dumpDB 返回数据库中的全部键值对
+func dumpDB(db kvstore.KVStore) map[string]string {
+	entries := make(map[string]string)
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		entries[string(iter.Key())] = string(iter.Value())
+	}
+	return entries
+}
+
+func TestSetupGenesis(t *testing.T) {
+	genesis, err := ReadGenesis(writeGenesis(t, testGenesis))
+	if err != nil {
+		t.Fatalf("ReadGenesis failed: %v", err)
+	}
+	db := memorydb.NewMemoryDB()
+	root, err := SetupGenesis(db, genesis)
+	if err != nil {
+		t.Fatalf("SetupGenesis failed: %v", err)
+	}
+
+	state, err := statdb.NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr1, addr2 := types.Address{1}, types.Address{2}
+	if acc := state.Load(addr1); acc.Amount != 1000000 || acc.Nonce != 2 {
+		t.Errorf("Unexpected addr1: %+v", acc)
+	}
+	if acc := state.Load(addr2); acc.Amount != 0xff {
+		t.Errorf("Unexpected addr2: %+v", acc)
+	}
+	if code := state.GetCode(addr2); !bytes.Equal(code, []byte{0x60, 0x60, 0x60, 0x40}) {
+		t.Errorf("Unexpected code %x", code)
+	}
+	if value := state.GetState(addr2, hash.Hash{31: 1}); value != (hash.Hash{31: 2}) {
+		t.Errorf("Unexpected storage %x", value)
+	}
+
+	// 相同的创世配置可以重复执行
+	if again, err := SetupGenesis(db, genesis); err != nil || again != root {
+		t.Fatalf("SetupGenesis again: got %x, %v", again, err)
+	}
+
+	// 不同的创世配置必须失败
+	other, err := ReadGenesis(writeGenesis(t, `{"alloc": {"0x0100000000000000000000000000000000000000": {"balance": "1"}}}`))
+	if err != nil {
+		t.Fatalf("ReadGenesis failed: %v", err)
+	}
+	before := dumpDB(db)
+	if _, err := SetupGenesis(db, other); !errors.Is(err, ErrGenesisMismatch) {
+		t.Fatalf("Expected ErrGenesisMismatch, got %v", err)
+	}
+	if after := dumpDB(db); !reflect.DeepEqual(before, after) {
+		t.Errorf("Mismatched genesis modified the database: %d entries before, %d after", len(before), len(after))
+	}
+
+	tooLarge, err := ReadGenesis(writeGenesis(t, `{"alloc": {"0x0100000000000000000000000000000000000000": {"balance": "0x10000000000000000"}}}`))
+	if err != nil {
+		t.Fatalf("ReadGenesis failed: %v", err)
+	}
+	if _, err := SetupGenesis(memorydb.NewMemoryDB(), tooLarge); !errors.Is(err, ErrBalanceTooLarge) {
+		t.Fatalf("Expected ErrBalanceTooLarge, got %v", err)
+	}
+}
@@ -4,12 +4,10 @@ go 1.24
 
 require (
 	github.com/ethereum/go-ethereum v1.15.11
+	github.com/golang/snappy v0.0.5-0.20220116011046-fa5810519dcb
 	github.com/holiman/uint256 v1.3.2
 	github.com/syndtr/goleveldb v1.0.1-0.20210819022825-2ae1ddf74ef7
 	golang.org/x/crypto v0.39.0
 )
 
-require (
-	github.com/golang/snappy v0.0.5-0.20220116011046-fa5810519dcb // indirect
-	golang.org/x/sys v0.33.0 // indirect
-)
+require golang.org/x/sys v0.33.0 // indirect
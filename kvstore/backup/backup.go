@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/utils/rlp"
+)
+
+const (
+	// Magic 标识备份文件格式
+	Magic = "hyblockchain-kvdump"
+	// Version 是当前的备份文件格式版本
+	Version = 1
+
+	defaultChunkSize = 1024
+)
+
+var (
+	ErrBadMagic        = errors.New("backup: not a database dump")
+	ErrVersion         = errors.New("backup: unsupported dump version")
+	ErrChecksum        = errors.New("backup: chunk checksum mismatch")
+	ErrIncomplete      = errors.New("backup: dump is incomplete")
+	ErrPrefixMismatch  = errors.New("backup: existing dump was taken with a different prefix")
+	ErrResumeNotFound  = errors.New("backup: resume point no longer exists in database")
+	errTrailingGarbage = errors.New("backup: data after final chunk")
+)
+
+// header 是备份文件的第一个 RLP 值
+type header struct {
+	Magic   string
+	Version uint64
+	Prefix  []byte
+}
+
+// entry 是一条键值对
+type entry struct {
+	Key   []byte
+	Value []byte
+}
+
+// chunkBody 是一个数据块中参与校验的部分
+type chunkBody struct {
+	Entries []entry
+	Total   uint64 // 包含本块在内已经导出的条目总数
+	Final   bool   // 最后一个块，表示导出已经完成
+}
+
+// chunk 是备份文件中的一个数据块，Checksum 为 chunkBody RLP 编码的 sha256
+type chunk struct {
+	Body     chunkBody
+	Checksum []byte
+}
+
+func newChunk(body chunkBody) (*chunk, error) {
+	enc, err := rlp.EncodeToBytes(&body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(enc)
+	return &chunk{Body: body, Checksum: sum[:]}, nil
+}
+
+func (c *chunk) verify() error {
+	enc, err := rlp.EncodeToBytes(&c.Body)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(enc)
+	if !bytes.Equal(sum[:], c.Checksum) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// ExportOptions 导出参数
+type ExportOptions struct {
+	Prefix    []byte             // 只导出以 Prefix 开头的键
+	ChunkSize int                // 每个数据块包含的条目数，0 表示使用默认值
+	Progress  func(total uint64) // 每写完一个数据块后回调已导出的条目数
+}
+
+// ImportOptions 导入参数
+type ImportOptions struct {
+	Skip     uint64             // 跳过前 Skip 条，用于从上次中断的位置继续
+	Progress func(total uint64) // 每写入一个数据块后回调已导入的条目数（含 Skip）
+}
+
+// Export 把 db 中的数据导出到 path。如果 path 是一个未完成的导出文件，
+// 会校验已写入的数据块并从最后一个完整块之后继续导出。
+// 续传依赖 db 的迭代顺序在两次导出之间保持不变
+func Export(db kvstore.KVStore, path string, opts ExportOptions) error {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, total, lastKey, done, err := scanExport(f, opts.Prefix)
+	if err != nil {
+		return err
+	}
+	if done {
+		if opts.Progress != nil {
+			opts.Progress(total)
+		}
+		return nil
+	}
+	if offset == 0 {
+		enc, err := rlp.EncodeToBytes(&header{Magic: Magic, Version: Version, Prefix: opts.Prefix})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(enc); err != nil {
+			return err
+		}
+	} else {
+		// 丢弃最后一个不完整的块
+		if err := f.Truncate(offset); err != nil {
+			return err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(f)
+	flush := func(entries []entry, final bool) error {
+		total += uint64(len(entries))
+		c, err := newChunk(chunkBody{Entries: entries, Total: total, Final: final})
+		if err != nil {
+			return err
+		}
+		if err := rlp.Encode(w, c); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(total)
+		}
+		return nil
+	}
+
+	iter := db.NewIterator(opts.Prefix)
+	defer iter.Release()
+
+	skipping := lastKey != nil
+	entries := make([]entry, 0, opts.ChunkSize)
+	for iter.Next() {
+		if skipping {
+			if bytes.Equal(iter.Key(), lastKey) {
+				skipping = false
+			}
+			continue
+		}
+		entries = append(entries, entry{
+			Key:   append([]byte{}, iter.Key()...),
+			Value: append([]byte{}, iter.Value()...),
+		})
+		if len(entries) == opts.ChunkSize {
+			if err := flush(entries, false); err != nil {
+				return err
+			}
+			entries = make([]entry, 0, opts.ChunkSize)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if skipping {
+		return ErrResumeNotFound
+	}
+	if err := flush(entries, true); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// scanExport 检查已有的导出文件，返回最后一个完整块之后的偏移、
+// 已导出的条目数、最后一个导出的键以及导出是否已经完成
+func scanExport(f *os.File, prefix []byte) (offset int64, total uint64, lastKey []byte, done bool, err error) {
+	stat, err := f.Stat()
+	if err != nil || stat.Size() == 0 {
+		return 0, 0, nil, false, err
+	}
+	stream := rlp.NewStream(bufio.NewReader(f), 0)
+	raw, err := stream.Raw()
+	if err != nil {
+		// 连文件头都没有写完整，从头开始
+		return 0, 0, nil, false, nil
+	}
+	var h header
+	if err := rlp.DecodeBytes(raw, &h); err != nil {
+		return 0, 0, nil, false, err
+	}
+	if err := h.check(); err != nil {
+		return 0, 0, nil, false, err
+	}
+	if !bytes.Equal(h.Prefix, prefix) {
+		return 0, 0, nil, false, ErrPrefixMismatch
+	}
+	offset = int64(len(raw))
+
+	for {
+		raw, err := stream.Raw()
+		if err != nil {
+			return offset, total, lastKey, false, nil
+		}
+		var c chunk
+		if err := rlp.DecodeBytes(raw, &c); err != nil || c.verify() != nil {
+			return offset, total, lastKey, false, nil
+		}
+		offset += int64(len(raw))
+		total = c.Body.Total
+		if n := len(c.Body.Entries); n > 0 {
+			lastKey = c.Body.Entries[n-1].Key
+		}
+		if c.Body.Final {
+			return offset, total, lastKey, true, nil
+		}
+	}
+}
+
+func (h *header) check() error {
+	if h.Magic != Magic {
+		return ErrBadMagic
+	}
+	if h.Version != Version {
+		return fmt.Errorf("%w: %d", ErrVersion, h.Version)
+	}
+	return nil
+}
+
+// Import 把 path 中的备份数据写入 db，每个数据块校验通过后作为一个批次写入。
+// 中断后可以把上次 Progress 回调的值作为 Skip 继续导入
+func Import(db kvstore.KVStore, path string, opts ImportOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stream := rlp.NewStream(bufio.NewReader(f), 0)
+	var h header
+	if err := stream.Decode(&h); err != nil {
+		return err
+	}
+	if err := h.check(); err != nil {
+		return err
+	}
+
+	var total uint64
+	for {
+		var c chunk
+		if err := stream.Decode(&c); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return ErrIncomplete
+			}
+			return err
+		}
+		if err := c.verify(); err != nil {
+			return err
+		}
+		start := total
+		total += uint64(len(c.Body.Entries))
+		if total != c.Body.Total {
+			return fmt.Errorf("%w: expected %d entries, chunk says %d", ErrChecksum, total, c.Body.Total)
+		}
+
+		if total > opts.Skip {
+			batch := db.Batch()
+			for i, e := range c.Body.Entries {
+				if start+uint64(i) < opts.Skip {
+					continue
+				}
+				batch.Put(e.Key, e.Value)
+			}
+			if err := db.Write(batch); err != nil {
+				return err
+			}
+			if opts.Progress != nil {
+				opts.Progress(total)
+			}
+		}
+		if c.Body.Final {
+			break
+		}
+	}
+	if _, err := stream.Raw(); err != io.EOF {
+		return errTrailingGarbage
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package cachedb
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"hyblockchain/kvstore"
+)
+
+// entryOverhead 是每个缓存项除键值外的估计内存开销
+const entryOverhead = 64
+
+// CacheDB 是一个读穿透的 KVStore 装饰器，用 LRU 缓存热点键，
+// 缓存占用的字节数不超过给定预算。不存在的键也会被缓存（负缓存）。
+// 所有写入（Put、Delete、批次、事务提交）都会使对应的缓存项失效
+type CacheDB struct {
+	db kvstore.KVStore
+
+	lock    sync.Mutex
+	budget  int
+	size    int
+	lru     *list.List               // 最近使用的在前
+	entries map[string]*list.Element // 键 -> lru 中的元素
+	seq     uint64                   // 写入序号，防止并发读取把旧值填回缓存
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cacheEntry 是一个缓存项，missing 表示该键不存在
+type cacheEntry struct {
+	key     string
+	value   []byte
+	missing bool
+}
+
+func (e *cacheEntry) size() int {
+	return len(e.key) + len(e.value) + entryOverhead
+}
+
+// NewCacheDB 用最多 budget 字节的缓存包装 db
+func NewCacheDB(db kvstore.KVStore, budget int) *CacheDB {
+	return &CacheDB{
+		db:      db,
+		budget:  budget,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Stats 返回缓存命中和未命中的次数
+func (c *CacheDB) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Size 返回缓存当前占用的字节数
+func (c *CacheDB) Size() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.size
+}
+
+// lookup 查找缓存项并标记为最近使用，同时返回当前写入序号
+func (c *CacheDB) lookup(key []byte) (*cacheEntry, uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[string(key)]
+	if !ok {
+		return nil, c.seq
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry), c.seq
+}
+
+// fill 把从底层存储读到的结果放入缓存。如果读取期间发生过写入则放弃，
+// 因为读到的可能已经是旧值
+func (c *CacheDB) fill(seq uint64, entry *cacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if seq != c.seq || entry.size() > c.budget {
+		return
+	}
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += entry.size()
+	for c.size > c.budget {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove 删除一个缓存项，调用方需持有锁
+func (c *CacheDB) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size()
+}
+
+// invalidate 在写入后使 keys 对应的缓存项失效
+func (c *CacheDB) invalidate(keys [][]byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.seq++
+	for _, key := range keys {
+		if elem, ok := c.entries[string(key)]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// Get 获取指定键的值，优先从缓存读取
+func (c *CacheDB) Get(key []byte) ([]byte, error) {
+	entry, seq := c.lookup(key)
+	if entry != nil {
+		c.hits.Add(1)
+		if entry.missing {
+			return nil, kvstore.ErrNotFound
+		}
+		return append([]byte{}, entry.value...), nil
+	}
+	c.misses.Add(1)
+
+	value, err := c.db.Get(key)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		c.fill(seq, &cacheEntry{key: string(key), missing: true})
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.fill(seq, &cacheEntry{key: string(key), value: append([]byte{}, value...)})
+	return value, nil
+}
+
+// Has 检查键是否存在，不存在的结果会被缓存
+func (c *CacheDB) Has(key []byte) (bool, error) {
+	entry, seq := c.lookup(key)
+	if entry != nil {
+		c.hits.Add(1)
+		return !entry.missing, nil
+	}
+	c.misses.Add(1)
+
+	has, err := c.db.Has(key)
+	if err != nil {
+		return false, err
+	}
+	if !has {
+		c.fill(seq, &cacheEntry{key: string(key), missing: true})
+	}
+	return has, nil
+}
+
+// Put 存储键值对并使缓存失效
+func (c *CacheDB) Put(key []byte, value []byte) error {
+	defer c.invalidate([][]byte{key})
+	return c.db.Put(key, value)
+}
+
+// Delete 删除指定键并使缓存失效
+func (c *CacheDB) Delete(key []byte) error {
+	defer c.invalidate([][]byte{key})
+	return c.db.Delete(key)
+}
+
+// Batch 创建新的批量操作
+func (c *CacheDB) Batch() kvstore.Batch {
+	return &cacheBatch{batch: c.db.Batch()}
+}
+
+// Write 执行批量操作并使批次涉及的缓存项失效
+func (c *CacheDB) Write(batch kvstore.Batch) error {
+	b, ok := batch.(*cacheBatch)
+	if !ok {
+		return errors.New("cachedb: batch was not created by CacheDB")
+	}
+	defer c.invalidate(b.keys)
+	return c.db.Write(b.batch)
+}
+
+// NewIterator 直接迭代底层存储
+func (c *CacheDB) NewIterator(prefix []byte) kvstore.Iterator {
+	return c.db.NewIterator(prefix)
+}
+
+// Begin 在底层存储上开启事务，提交后使写过的缓存项失效
+func (c *CacheDB) Begin() kvstore.Transaction {
+	return &cacheTx{db: c, tx: c.db.Begin()}
+}
+
+// Close 清空缓存并关闭底层存储
+func (c *CacheDB) Close() error {
+	c.lock.Lock()
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+	c.lock.Unlock()
+
+	return c.db.Close()
+}
+
+// cacheBatch 实现了Batch接口，记录批次涉及的键
+type cacheBatch struct {
+	batch kvstore.Batch
+	keys  [][]byte
+}
+
+func (b *cacheBatch) Put(key, value []byte) {
+	b.batch.Put(key, value)
+	b.keys = append(b.keys, append([]byte{}, key...))
+}
+
+func (b *cacheBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+	b.keys = append(b.keys, append([]byte{}, key...))
+}
+
+func (b *cacheBatch) Reset() {
+	b.batch.Reset()
+	b.keys = b.keys[:0]
+}
+
+func (b *cacheBatch) Len() int {
+	return b.batch.Len()
+}
+
+// cacheTx 实现了Transaction接口，读取绕过缓存以便底层做冲突检测
+type cacheTx struct {
+	db   *CacheDB
+	tx   kvstore.Transaction
+	keys [][]byte
+}
+
+func (t *cacheTx) Get(key []byte) ([]byte, error) {
+	return t.tx.Get(key)
+}
+
+func (t *cacheTx) Put(key []byte, value []byte) error {
+	t.keys = append(t.keys, append([]byte{}, key...))
+	return t.tx.Put(key, value)
+}
+
+func (t *cacheTx) Delete(key []byte) error {
+	t.keys = append(t.keys, append([]byte{}, key...))
+	return t.tx.Delete(key)
+}
+
+func (t *cacheTx) Commit() error {
+	defer t.db.invalidate(t.keys)
+	return t.tx.Commit()
+}
+
+func (t *cacheTx) Rollback() {
+	t.tx.Rollback()
+}
@@ -0,0 +1,94 @@
+package cachedb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+)
+
+func TestCacheDB(t *testing.T) {
+	db := NewCacheDB(memorydb.NewMemoryDB(), 1024)
+	defer db.Close()
+
+	db.Put([]byte("a"), []byte("1"))
+
+	// 第一次读取未命中，第二次命中
+	db.Get([]byte("a"))
+	if got, _ := db.Get([]byte("a")); string(got) != "1" {
+		t.Fatalf("Expected 1, got %s", got)
+	}
+	if hits, misses := db.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d/%d", hits, misses)
+	}
+
+	// Put 使缓存失效
+	db.Put([]byte("a"), []byte("2"))
+	if got, _ := db.Get([]byte("a")); string(got) != "2" {
+		t.Errorf("Expected 2 after Put, got %s", got)
+	}
+
+	// 负缓存：Has 返回 false 后再次查询命中缓存
+	if has, _ := db.Has([]byte("missing")); has {
+		t.Fatalf("Expected missing key")
+	}
+	hits, _ := db.Stats()
+	if _, err := db.Get([]byte("missing")); !errors.Is(err, kvstore.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from negative cache, got %v", err)
+	}
+	if h, _ := db.Stats(); h != hits+1 {
+		t.Errorf("Expected negative entry to be a cache hit")
+	}
+
+	// 批次写入使负缓存失效
+	batch := db.Batch()
+	batch.Put([]byte("missing"), []byte("now here"))
+	batch.Delete([]byte("a"))
+	if err := db.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if got, _ := db.Get([]byte("missing")); string(got) != "now here" {
+		t.Errorf("Expected batch write to invalidate negative entry, got %s", got)
+	}
+	if has, _ := db.Has([]byte("a")); has {
+		t.Errorf("Expected a to be deleted by batch")
+	}
+
+	// 事务提交使缓存失效
+	db.Get([]byte("missing"))
+	tx := db.Begin()
+	tx.Put([]byte("missing"), []byte("via tx"))
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if got, _ := db.Get([]byte("missing")); string(got) != "via tx" {
+		t.Errorf("Expected transaction commit to invalidate cache, got %s", got)
+	}
+}
+
+func TestCacheDBBudget(t *testing.T) {
+	budget := 10 * (entryOverhead + 10)
+	db := NewCacheDB(memorydb.NewMemoryDB(), budget)
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		db.Put(key, []byte("v"))
+		db.Get(key)
+	}
+	if db.Size() > budget {
+		t.Errorf("Cache size %d exceeds budget %d", db.Size(), budget)
+	}
+	// 最近使用的键仍在缓存中，最早的已被淘汰
+	_, misses := db.Stats()
+	db.Get([]byte("key-0099"))
+	if _, m := db.Stats(); m != misses {
+		t.Errorf("Expected most recent key to be cached")
+	}
+	db.Get([]byte("key-0000"))
+	if _, m := db.Stats(); m != misses+1 {
+		t.Errorf("Expected oldest key to be evicted")
+	}
+}
@@ -0,0 +1,424 @@
+package encdb
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"hyblockchain/kvstore"
+)
+
+// envelopeVersion 是密文格式的版本号
+const envelopeVersion = 1
+
+var (
+	// dataPrefix 是所有加密数据在底层存储中的键前缀
+	dataPrefix = []byte("enc-")
+	// checkKey 保存一段用当前密钥加密的已知明文，用来在打开时校验密钥
+	checkKey   = []byte("encdb-keycheck")
+	checkValue = []byte("hyblockchain encdb key check")
+
+	ErrWrongKey    = errors.New("encdb: wrong encryption key or corrupted data")
+	ErrInvalidKey  = errors.New("encdb: key must be 16, 24 or 32 bytes")
+	ErrBadEnvelope = errors.New("encdb: malformed ciphertext")
+)
+
+// EncDB 是一个 KVStore 装饰器，写入底层存储前用 AES-GCM 加密值。
+//
+// 键使用 HMAC-SHA256 做确定性映射，因此 Get/Has/Delete 不需要解密即可定位。
+// 原始键被加密保存在值里，NewIterator 会扫描全部加密数据、解密后再按前缀
+// 过滤，所以前缀迭代可以使用，但代价是全表扫描，且结果不按键排序。
+type EncDB struct {
+	lock sync.RWMutex
+	db   kvstore.KVStore
+	keys *keySet
+}
+
+// keySet 是由主密钥派生出的一组密钥
+type keySet struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// newKeySet 从主密钥派生加密密钥和 MAC 密钥
+func newKeySet(master []byte) (*keySet, error) {
+	switch len(master) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(derive(master, "enc")[:len(master)])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keySet{aead: aead, macKey: derive(master, "mac")}, nil
+}
+
+// derive 用 HMAC 从主密钥派生出用途为 label 的子密钥
+func derive(master []byte, label string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("hyblockchain-encdb-" + label))
+	return mac.Sum(nil)
+}
+
+// storageKey 计算键在底层存储中的位置
+func (k *keySet) storageKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, k.macKey)
+	mac.Write(key)
+	return mac.Sum(append([]byte{}, dataPrefix...))
+}
+
+// seal 加密 (key, value)，底层存储键作为附加数据，防止密文被挪到别的键下
+func (k *keySet) seal(skey, key, value []byte) ([]byte, error) {
+	plain := binary.AppendUvarint(nil, uint64(len(key)))
+	plain = append(plain, key...)
+	plain = append(plain, value...)
+
+	out := make([]byte, 1+k.aead.NonceSize(), 1+k.aead.NonceSize()+len(plain)+k.aead.Overhead())
+	out[0] = envelopeVersion
+	if _, err := rand.Read(out[1:]); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(out, out[1:], plain, skey), nil
+}
+
+// open 解密 seal 生成的密文，返回原始键和值
+func (k *keySet) open(skey, data []byte) ([]byte, []byte, error) {
+	if len(data) < 1+k.aead.NonceSize() || data[0] != envelopeVersion {
+		return nil, nil, ErrBadEnvelope
+	}
+	nonce := data[1 : 1+k.aead.NonceSize()]
+	plain, err := k.aead.Open(nil, nonce, data[1+k.aead.NonceSize():], skey)
+	if err != nil {
+		return nil, nil, ErrWrongKey
+	}
+	n, size := binary.Uvarint(plain)
+	if size <= 0 || uint64(len(plain)-size) < n {
+		return nil, nil, ErrBadEnvelope
+	}
+	key := plain[size : size+int(n)]
+	return key, plain[size+int(n):], nil
+}
+
+// NewEncDB 用主密钥 key 包装 db。首次使用时写入密钥校验记录，
+// 之后用错误的密钥打开会返回 ErrWrongKey
+func NewEncDB(db kvstore.KVStore, key []byte) (*EncDB, error) {
+	keys, err := newKeySet(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyKey(db, keys); err != nil {
+		return nil, err
+	}
+	return &EncDB{db: db, keys: keys}, nil
+}
+
+// verifyKey 校验密钥，不存在校验记录时写入一条
+func verifyKey(db kvstore.KVStore, keys *keySet) error {
+	has, err := db.Has(checkKey)
+	if err != nil {
+		return err
+	}
+	if !has {
+		check, err := keys.seal(checkKey, nil, checkValue)
+		if err != nil {
+			return err
+		}
+		return db.Put(checkKey, check)
+	}
+	data, err := db.Get(checkKey)
+	if err != nil {
+		return err
+	}
+	_, value, err := keys.open(checkKey, data)
+	if err != nil || !bytes.Equal(value, checkValue) {
+		return ErrWrongKey
+	}
+	return nil
+}
+
+// Get 获取并解密指定键的值
+func (e *EncDB) Get(key []byte) ([]byte, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	skey := e.keys.storageKey(key)
+	data, err := e.db.Get(skey)
+	if err != nil {
+		return nil, err
+	}
+	_, value, err := e.keys.open(skey, data)
+	return value, err
+}
+
+// Put 加密并存储键值对
+func (e *EncDB) Put(key []byte, value []byte) error {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	skey := e.keys.storageKey(key)
+	data, err := e.keys.seal(skey, key, value)
+	if err != nil {
+		return err
+	}
+	return e.db.Put(skey, data)
+}
+
+// Delete 删除指定键
+func (e *EncDB) Delete(key []byte) error {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.db.Delete(e.keys.storageKey(key))
+}
+
+// Has 检查键是否存在
+func (e *EncDB) Has(key []byte) (bool, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.db.Has(e.keys.storageKey(key))
+}
+
+// Batch 创建新的批量操作，值在加入批次时加密
+func (e *EncDB) Batch() kvstore.Batch {
+	return &encBatch{db: e, batch: e.db.Batch()}
+}
+
+// Write 执行批量操作
+func (e *EncDB) Write(batch kvstore.Batch) error {
+	b, ok := batch.(*encBatch)
+	if !ok {
+		return errors.New("encdb: batch was not created by EncDB")
+	}
+	if b.err != nil {
+		return b.err
+	}
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	if b.keys != nil && b.keys != e.keys {
+		return errors.New("encdb: batch was created before key rotation")
+	}
+	return e.db.Write(b.batch)
+}
+
+// NewIterator 扫描全部加密数据，返回原始键以 prefix 开头的键值对。
+// 迭代需要解密每一条数据，结果不保证按键排序
+func (e *EncDB) NewIterator(prefix []byte) kvstore.Iterator {
+	e.lock.RLock()
+	keys := e.keys
+	e.lock.RUnlock()
+
+	return &encIterator{
+		iter:   e.db.NewIterator(dataPrefix),
+		keys:   keys,
+		prefix: prefix,
+	}
+}
+
+// Begin 在底层存储上开启一个乐观事务，键和值在事务内完成加密
+func (e *EncDB) Begin() kvstore.Transaction {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return &encTx{db: e, keys: e.keys, tx: e.db.Begin()}
+}
+
+// Rotate 把所有数据用新密钥重新加密。所有改动放在同一个批次里原子写入，
+// 因此需要的内存与数据量成正比；轮换期间其他读写会被阻塞
+func (e *EncDB) Rotate(newKey []byte) error {
+	keys, err := newKeySet(newKey)
+	if err != nil {
+		return err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	batch := e.db.Batch()
+	iter := e.db.NewIterator(dataPrefix)
+	for iter.Next() {
+		skey := iter.Key()
+		key, value, err := e.keys.open(skey, iter.Value())
+		if err != nil {
+			iter.Release()
+			return err
+		}
+		newSKey := keys.storageKey(key)
+		data, err := keys.seal(newSKey, key, value)
+		if err != nil {
+			iter.Release()
+			return err
+		}
+		batch.Delete(append([]byte{}, skey...))
+		batch.Put(newSKey, data)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	check, err := keys.seal(checkKey, nil, checkValue)
+	if err != nil {
+		return err
+	}
+	batch.Put(checkKey, check)
+	if err := e.db.Write(batch); err != nil {
+		return err
+	}
+	e.keys = keys
+	return nil
+}
+
+// Close 关闭底层存储
+func (e *EncDB) Close() error {
+	return e.db.Close()
+}
+
+// encBatch 实现了Batch接口，记录加密时出现的错误并在 Write 时返回
+type encBatch struct {
+	db    *EncDB
+	keys  *keySet
+	batch kvstore.Batch
+	err   error
+}
+
+func (b *encBatch) keySet() *keySet {
+	if b.keys == nil {
+		b.db.lock.RLock()
+		b.keys = b.db.keys
+		b.db.lock.RUnlock()
+	}
+	return b.keys
+}
+
+func (b *encBatch) Put(key, value []byte) {
+	keys := b.keySet()
+	skey := keys.storageKey(key)
+	data, err := keys.seal(skey, key, value)
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return
+	}
+	b.batch.Put(skey, data)
+}
+
+func (b *encBatch) Delete(key []byte) {
+	b.batch.Delete(b.keySet().storageKey(key))
+}
+
+func (b *encBatch) Reset() {
+	b.batch.Reset()
+	b.keys = nil
+	b.err = nil
+}
+
+func (b *encBatch) Len() int {
+	return b.batch.Len()
+}
+
+// encTx 实现了Transaction接口，把读写映射到底层事务上
+type encTx struct {
+	db   *EncDB
+	keys *keySet
+	tx   kvstore.Transaction
+}
+
+func (t *encTx) Get(key []byte) ([]byte, error) {
+	skey := t.keys.storageKey(key)
+	data, err := t.tx.Get(skey)
+	if err != nil {
+		return nil, err
+	}
+	_, value, err := t.keys.open(skey, data)
+	return value, err
+}
+
+func (t *encTx) Put(key []byte, value []byte) error {
+	skey := t.keys.storageKey(key)
+	data, err := t.keys.seal(skey, key, value)
+	if err != nil {
+		return err
+	}
+	return t.tx.Put(skey, data)
+}
+
+func (t *encTx) Delete(key []byte) error {
+	return t.tx.Delete(t.keys.storageKey(key))
+}
+
+// Commit 提交事务，事务开始后发生过密钥轮换时放弃提交
+func (t *encTx) Commit() error {
+	t.db.lock.RLock()
+	defer t.db.lock.RUnlock()
+
+	if t.keys != t.db.keys {
+		t.tx.Rollback()
+		return kvstore.ErrTxConflict
+	}
+	return t.tx.Commit()
+}
+
+func (t *encTx) Rollback() {
+	t.tx.Rollback()
+}
+
+// encIterator 实现了Iterator接口，解密底层数据并按原始键前缀过滤
+type encIterator struct {
+	iter   kvstore.Iterator
+	keys   *keySet
+	prefix []byte
+
+	key, value []byte
+	err        error
+}
+
+func (i *encIterator) Next() bool {
+	if i.err != nil {
+		return false
+	}
+	for i.iter.Next() {
+		key, value, err := i.keys.open(i.iter.Key(), i.iter.Value())
+		if err != nil {
+			i.err = err
+			return false
+		}
+		if bytes.HasPrefix(key, i.prefix) {
+			i.key, i.value = key, value
+			return true
+		}
+	}
+	return false
+}
+
+func (i *encIterator) Key() []byte {
+	return i.key
+}
+
+func (i *encIterator) Value() []byte {
+	return i.value
+}
+
+func (i *encIterator) Error() error {
+	if i.err != nil {
+		return i.err
+	}
+	return i.iter.Error()
+}
+
+func (i *encIterator) Release() {
+	i.iter.Release()
+}
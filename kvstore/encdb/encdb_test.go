@@ -0,0 +1,113 @@
+package encdb
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"hyblockchain/kvstore/leveldb"
+)
+
+func TestEncDB(t *testing.T) {
+	dbPath := "testdb_encdb"
+	defer os.RemoveAll(dbPath)
+
+	raw, err := leveldb.NewLevelDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	defer raw.Close()
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	db, err := NewEncDB(raw, key1)
+	if err != nil {
+		t.Fatalf("NewEncDB failed: %v", err)
+	}
+
+	if err := db.Put([]byte("acc-1"), []byte("100")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	batch := db.Batch()
+	batch.Put([]byte("acc-2"), []byte("200"))
+	batch.Put([]byte("code-1"), []byte("0x6060"))
+	if err := db.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	got, err := db.Get([]byte("acc-1"))
+	if err != nil || string(got) != "100" {
+		t.Fatalf("Get acc-1: got %s, %v", got, err)
+	}
+	if has, _ := db.Has([]byte("acc-2")); !has {
+		t.Errorf("Expected acc-2 to exist")
+	}
+
+	// 底层存储中不应出现明文
+	iter := raw.NewIterator(nil)
+	for iter.Next() {
+		if bytes.Contains(iter.Key(), []byte("acc")) || bytes.Contains(iter.Value(), []byte("acc")) {
+			t.Errorf("Plaintext leaked into underlying store: %x", iter.Key())
+		}
+	}
+	iter.Release()
+
+	// 前缀迭代
+	count := 0
+	iter = db.NewIterator([]byte("acc-"))
+	for iter.Next() {
+		if !bytes.HasPrefix(iter.Key(), []byte("acc-")) {
+			t.Errorf("Unexpected key %s", iter.Key())
+		}
+		count++
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		t.Fatalf("Iterator error: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 entries with prefix acc-, got %d", count)
+	}
+
+	// 错误的密钥
+	if _, err := NewEncDB(raw, bytes.Repeat([]byte{2}, 32)); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey, got %v", err)
+	}
+
+	// 密钥轮换
+	key2 := bytes.Repeat([]byte{3}, 32)
+	if err := db.Rotate(key2); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, err := NewEncDB(raw, key1); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected old key to be rejected after rotation, got %v", err)
+	}
+	db2, err := NewEncDB(raw, key2)
+	if err != nil {
+		t.Fatalf("NewEncDB with rotated key failed: %v", err)
+	}
+	got, err = db2.Get([]byte("code-1"))
+	if err != nil || string(got) != "0x6060" {
+		t.Fatalf("Get code-1 after rotation: got %s, %v", got, err)
+	}
+
+	// 事务
+	tx := db2.Begin()
+	tx.Put([]byte("acc-3"), []byte("300"))
+	if v, err := tx.Get([]byte("acc-3")); err != nil || string(v) != "300" {
+		t.Fatalf("Get in transaction: got %s, %v", v, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if v, err := db2.Get([]byte("acc-3")); err != nil || string(v) != "300" {
+		t.Fatalf("Get after commit: got %s, %v", v, err)
+	}
+
+	if err := db2.Delete([]byte("acc-1")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if has, _ := db2.Has([]byte("acc-1")); has {
+		t.Errorf("Expected acc-1 to be deleted")
+	}
+}
@@ -0,0 +1,385 @@
+package faultdb
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"hyblockchain/kvstore"
+)
+
+var (
+	ErrInjected = errors.New("faultdb: injected write failure")
+	ErrCrashed  = errors.New("faultdb: store crashed")
+)
+
+// Config 描述要注入的故障，零值表示不注入任何故障
+type Config struct {
+	FailWriteAt int     // 第 N 次写操作（从 1 开始）返回 ErrInjected，不写入数据
+	CrashAfter  int     // 完成 N 次写操作后模拟崩溃，之后所有操作返回 ErrCrashed
+	CrashRate   float64 // 每次写操作之前以该概率模拟崩溃
+	CorruptRate float64 // 每次 Get 以该概率返回被篡改的数据
+	Buffered    bool    // 写入先缓存在内存中，调用 Flush 后才写到底层存储，崩溃时丢弃
+	Seed        int64   // 随机数种子，便于复现
+}
+
+// FaultDB 是一个 KVStore 装饰器，按 Config 在读写路径上注入故障，
+// 用来测试 mpt、交易池等子系统在崩溃和磁盘错误下的表现。
+// Put、Delete、Write 以及事务提交各计为一次写操作
+type FaultDB struct {
+	lock    sync.Mutex
+	db      kvstore.KVStore
+	cfg     Config
+	rand    *rand.Rand
+	txs     *kvstore.TxTracker
+	writes  int
+	crashed bool
+	pending []op // Buffered 模式下尚未刷到底层存储的写入
+}
+
+// op 是一次写入或删除
+type op struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// New 用 cfg 包装 db
+func New(db kvstore.KVStore, cfg Config) *FaultDB {
+	return &FaultDB{
+		db:   db,
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(cfg.Seed)),
+		txs:  kvstore.NewTxTracker(),
+	}
+}
+
+// Writes 返回已经尝试过的写操作次数
+func (f *FaultDB) Writes() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.writes
+}
+
+// Crashed 返回是否已经模拟了崩溃
+func (f *FaultDB) Crashed() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.crashed
+}
+
+// Crash 立即模拟崩溃，丢弃所有未刷盘的写入
+func (f *FaultDB) Crash() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.crash()
+}
+
+func (f *FaultDB) crash() {
+	f.crashed = true
+	f.pending = nil
+}
+
+// Flush 把缓存的写入作为一个批次写到底层存储
+func (f *FaultDB) Flush() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.crashed {
+		return ErrCrashed
+	}
+	if len(f.pending) == 0 {
+		return nil
+	}
+	batch := f.db.Batch()
+	for _, o := range f.pending {
+		if o.delete {
+			batch.Delete(o.key)
+		} else {
+			batch.Put(o.key, o.value)
+		}
+	}
+	if err := f.db.Write(batch); err != nil {
+		return err
+	}
+	f.pending = nil
+	return nil
+}
+
+// beforeWrite 统计写操作次数并决定是否注入故障，调用方需持有锁
+func (f *FaultDB) beforeWrite() error {
+	if f.crashed {
+		return ErrCrashed
+	}
+	f.writes++
+	if f.cfg.CrashAfter > 0 && f.writes > f.cfg.CrashAfter {
+		f.crash()
+		return ErrCrashed
+	}
+	if f.cfg.CrashRate > 0 && f.rand.Float64() < f.cfg.CrashRate {
+		f.crash()
+		return ErrCrashed
+	}
+	if f.writes == f.cfg.FailWriteAt {
+		return ErrInjected
+	}
+	return nil
+}
+
+// apply 执行一组写入，调用方需持有锁
+func (f *FaultDB) apply(ops []op) error {
+	if err := f.beforeWrite(); err != nil {
+		return err
+	}
+	if f.cfg.Buffered {
+		f.pending = append(f.pending, ops...)
+		return nil
+	}
+	if len(ops) == 1 {
+		if ops[0].delete {
+			return f.db.Delete(ops[0].key)
+		}
+		return f.db.Put(ops[0].key, ops[0].value)
+	}
+	batch := f.db.Batch()
+	for _, o := range ops {
+		if o.delete {
+			batch.Delete(o.key)
+		} else {
+			batch.Put(o.key, o.value)
+		}
+	}
+	return f.db.Write(batch)
+}
+
+// Get 获取指定键的值，可能返回被篡改的数据
+func (f *FaultDB) Get(key []byte) ([]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.crashed {
+		return nil, ErrCrashed
+	}
+	value, err := f.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) > 0 && f.cfg.CorruptRate > 0 && f.rand.Float64() < f.cfg.CorruptRate {
+		value = append([]byte{}, value...)
+		value[f.rand.Intn(len(value))] ^= byte(1 + f.rand.Intn(255))
+	}
+	return value, nil
+}
+
+// get 先查未刷盘的写入再查底层存储，调用方需持有锁
+func (f *FaultDB) get(key []byte) ([]byte, error) {
+	if o := f.lookupPending(key); o != nil {
+		if o.delete {
+			return nil, kvstore.ErrNotFound
+		}
+		return append([]byte{}, o.value...), nil
+	}
+	return f.db.Get(key)
+}
+
+// lookupPending 返回对 key 最近一次未刷盘的写入，调用方需持有锁
+func (f *FaultDB) lookupPending(key []byte) *op {
+	for i := len(f.pending) - 1; i >= 0; i-- {
+		if bytes.Equal(f.pending[i].key, key) {
+			return &f.pending[i]
+		}
+	}
+	return nil
+}
+
+// Put 存储键值对
+func (f *FaultDB) Put(key []byte, value []byte) error {
+	return f.txs.Update([][]byte{key}, func() error {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+
+		return f.apply([]op{{key: append([]byte{}, key...), value: append([]byte{}, value...)}})
+	})
+}
+
+// Delete 删除指定键
+func (f *FaultDB) Delete(key []byte) error {
+	return f.txs.Update([][]byte{key}, func() error {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+
+		return f.apply([]op{{key: append([]byte{}, key...), delete: true}})
+	})
+}
+
+// Has 检查键是否存在
+func (f *FaultDB) Has(key []byte) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.crashed {
+		return false, ErrCrashed
+	}
+	if o := f.lookupPending(key); o != nil {
+		return !o.delete, nil
+	}
+	return f.db.Has(key)
+}
+
+// Batch 创建新的批量操作
+func (f *FaultDB) Batch() kvstore.Batch {
+	return &faultBatch{}
+}
+
+// Write 执行批量操作，整个批次计为一次写操作
+func (f *FaultDB) Write(batch kvstore.Batch) error {
+	b, ok := batch.(*faultBatch)
+	if !ok {
+		return errors.New("faultdb: batch was not created by FaultDB")
+	}
+	keys := make([][]byte, len(b.ops))
+	for i, o := range b.ops {
+		keys[i] = o.key
+	}
+	return f.txs.Update(keys, func() error {
+		return f.write(b)
+	})
+}
+
+// write 直接写入批次，不经过事务记录
+func (f *FaultDB) write(batch kvstore.Batch) error {
+	b, ok := batch.(*faultBatch)
+	if !ok {
+		return errors.New("faultdb: batch was not created by FaultDB")
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(b.ops) == 0 {
+		return nil
+	}
+	return f.apply(b.ops)
+}
+
+// NewIterator 创建新的迭代器，结果包含尚未刷盘的写入
+func (f *FaultDB) NewIterator(prefix []byte) kvstore.Iterator {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.crashed {
+		return &sliceIterator{err: ErrCrashed, index: -1}
+	}
+	if len(f.pending) == 0 {
+		return f.db.NewIterator(prefix)
+	}
+
+	// 把底层数据和未刷盘的写入合并成一个快照
+	entries := make(map[string][]byte)
+	iter := f.db.NewIterator(prefix)
+	for iter.Next() {
+		entries[string(iter.Key())] = append([]byte{}, iter.Value()...)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return &sliceIterator{err: err, index: -1}
+	}
+	for _, o := range f.pending {
+		if !bytes.HasPrefix(o.key, prefix) {
+			continue
+		}
+		if o.delete {
+			delete(entries, string(o.key))
+		} else {
+			entries[string(o.key)] = o.value
+		}
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	it := &sliceIterator{index: -1}
+	for _, key := range keys {
+		it.keys = append(it.keys, []byte(key))
+		it.values = append(it.values, entries[key])
+	}
+	return it
+}
+
+// Begin 开启一个乐观事务，提交时计为一次写操作
+func (f *FaultDB) Begin() kvstore.Transaction {
+	return f.txs.Begin(f, f.write)
+}
+
+// Close 关闭底层存储，未刷盘的写入会被丢弃
+func (f *FaultDB) Close() error {
+	f.lock.Lock()
+	f.pending = nil
+	f.lock.Unlock()
+
+	return f.db.Close()
+}
+
+// faultBatch 实现了Batch接口
+type faultBatch struct {
+	ops []op
+}
+
+func (b *faultBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, op{key: append([]byte{}, key...), value: append([]byte{}, value...)})
+}
+
+func (b *faultBatch) Delete(key []byte) {
+	b.ops = append(b.ops, op{key: append([]byte{}, key...), delete: true})
+}
+
+func (b *faultBatch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+func (b *faultBatch) Len() int {
+	return len(b.ops)
+}
+
+// sliceIterator 实现了Iterator接口，迭代内存中的一组键值对
+type sliceIterator struct {
+	keys   [][]byte
+	values [][]byte
+	index  int
+	err    error
+}
+
+func (i *sliceIterator) Next() bool {
+	if i.err != nil || i.index >= len(i.keys) {
+		return false
+	}
+	i.index++
+	return i.index < len(i.keys)
+}
+
+func (i *sliceIterator) Key() []byte {
+	if i.index < 0 || i.index >= len(i.keys) {
+		return nil
+	}
+	return i.keys[i.index]
+}
+
+func (i *sliceIterator) Value() []byte {
+	if i.index < 0 || i.index >= len(i.keys) {
+		return nil
+	}
+	return i.values[i.index]
+}
+
+func (i *sliceIterator) Error() error {
+	return i.err
+}
+
+func (i *sliceIterator) Release() {
+	i.keys, i.values = nil, nil
+}
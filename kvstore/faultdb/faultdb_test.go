@@ -0,0 +1,104 @@
+package faultdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/leveldb"
+	"hyblockchain/kvstore/memorydb"
+)
+
+func TestFaultDB(t *testing.T) {
+	db := New(memorydb.NewMemoryDB(), Config{FailWriteAt: 2, CrashAfter: 3})
+	defer db.Close()
+
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatalf("Put 1 failed: %v", err)
+	}
+	if err := db.Put([]byte("b"), []byte("2")); !errors.Is(err, ErrInjected) {
+		t.Fatalf("Expected ErrInjected on write 2, got %v", err)
+	}
+	if has, _ := db.Has([]byte("b")); has {
+		t.Errorf("Failed write should not be applied")
+	}
+	if err := db.Put([]byte("c"), []byte("3")); err != nil {
+		t.Fatalf("Put 3 failed: %v", err)
+	}
+	if err := db.Put([]byte("d"), []byte("4")); !errors.Is(err, ErrCrashed) {
+		t.Fatalf("Expected ErrCrashed on write 4, got %v", err)
+	}
+	if _, err := db.Get([]byte("a")); !errors.Is(err, ErrCrashed) {
+		t.Errorf("Expected reads to fail after crash, got %v", err)
+	}
+}
+
+func TestFaultDBBufferedAndCorrupt(t *testing.T) {
+	raw := memorydb.NewMemoryDB()
+	db := New(raw, Config{Buffered: true, CorruptRate: 1})
+
+	db.Put([]byte("a"), []byte("hello"))
+	if has, _ := raw.Has([]byte("a")); has {
+		t.Fatalf("Buffered write should not reach the underlying store before Flush")
+	}
+	if got, _ := db.Get([]byte("a")); string(got) == "hello" {
+		t.Errorf("Expected corrupted read")
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	db.Put([]byte("b"), []byte("lost"))
+	db.Crash()
+	if has, _ := raw.Has([]byte("a")); !has {
+		t.Errorf("Flushed write should survive crash")
+	}
+	if has, _ := raw.Has([]byte("b")); has {
+		t.Errorf("Unflushed write should be dropped by crash")
+	}
+}
+
+func TestHarness(t *testing.T) {
+	dbPath := "testdb_faultdb"
+	defer os.RemoveAll(dbPath)
+
+	// 不变量：a-i 和 b-i 总是成对出现
+	check := func(db kvstore.KVStore) error {
+		for i := 0; i < 20; i++ {
+			hasA, _ := db.Has([]byte(fmt.Sprintf("a-%d", i)))
+			hasB, _ := db.Has([]byte(fmt.Sprintf("b-%d", i)))
+			if hasA != hasB {
+				return fmt.Errorf("pair %d is torn", i)
+			}
+		}
+		return nil
+	}
+	workload := func(db kvstore.KVStore) error {
+		for i := 0; i < 20; i++ {
+			batch := db.Batch()
+			batch.Put([]byte(fmt.Sprintf("a-%d", i)), []byte("x"))
+			batch.Put([]byte(fmt.Sprintf("b-%d", i)), []byte("y"))
+			if err := db.Write(batch); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for seed := int64(0); seed < 5; seed++ {
+		os.RemoveAll(dbPath)
+		h := &Harness{
+			Open:   func() (kvstore.KVStore, error) { return leveldb.NewLevelDB(dbPath) },
+			Config: Config{CrashRate: 0.1, Seed: seed},
+			Check:  check,
+		}
+		res, err := h.Run(workload)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if res.WorkloadErr != nil && !IsInjected(res.WorkloadErr) {
+			t.Fatalf("seed %d: unexpected workload error %v", seed, res.WorkloadErr)
+		}
+	}
+}
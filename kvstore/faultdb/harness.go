@@ -0,0 +1,65 @@
+package faultdb
+
+import (
+	"errors"
+	"fmt"
+
+	"hyblockchain/kvstore"
+)
+
+// Harness 在注入故障的存储上运行一段负载，然后像进程重启一样
+// 重新打开底层存储并检查不变量
+type Harness struct {
+	// Open 打开底层存储，每次调用都应看到上一次关闭前持久化的数据
+	Open func() (kvstore.KVStore, error)
+	// Config 是运行负载时注入的故障
+	Config Config
+	// Check 在重新打开的存储上检查不变量，返回错误表示数据不一致
+	Check func(db kvstore.KVStore) error
+}
+
+// Result 记录一次运行的情况
+type Result struct {
+	Writes      int   // 负载尝试的写操作次数
+	Crashed     bool  // 负载运行期间是否发生了模拟崩溃
+	WorkloadErr error // 负载返回的错误，注入的故障通常会出现在这里
+}
+
+// Run 运行 workload。无论负载是否出错，结束时都会模拟一次崩溃，
+// 丢弃 Buffered 模式下未刷盘的写入，再重新打开存储运行 Check。
+// 只有打开存储或 Check 失败时才返回错误
+func (h *Harness) Run(workload func(db kvstore.KVStore) error) (*Result, error) {
+	db, err := h.Open()
+	if err != nil {
+		return nil, err
+	}
+	fdb := New(db, h.Config)
+	werr := workload(fdb)
+	res := &Result{
+		Writes:      fdb.Writes(),
+		Crashed:     fdb.Crashed(),
+		WorkloadErr: werr,
+	}
+	fdb.Crash()
+	if err := db.Close(); err != nil {
+		return res, err
+	}
+
+	db, err = h.Open()
+	if err != nil {
+		return res, fmt.Errorf("faultdb: reopen after crash: %w", err)
+	}
+	defer db.Close()
+
+	if h.Check != nil {
+		if err := h.Check(db); err != nil {
+			return res, fmt.Errorf("faultdb: invariant violated after %d writes: %w", res.Writes, err)
+		}
+	}
+	return res, nil
+}
+
+// IsInjected 判断 err 是否由故障注入产生
+func IsInjected(err error) bool {
+	return errors.Is(err, ErrInjected) || errors.Is(err, ErrCrashed)
+}
@@ -0,0 +1,167 @@
+package freezer
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"hyblockchain/kvstore"
+)
+
+// Freezer 实现了 kvstore.AncientStore 接口，把不再变化的历史数据
+// 按类别保存在只追加的平面文件表中
+type Freezer struct {
+	lock   sync.RWMutex
+	tables map[string]*table
+}
+
+// NewFreezer 在 dir 目录下打开或创建一个 freezer。tables 给出所有数据类别，
+// 值表示该类别是否使用 snappy 压缩。打开时会把各张表对齐到相同的头尾位置
+func NewFreezer(dir string, tables map[string]bool) (kvstore.AncientStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f := &Freezer{tables: make(map[string]*table)}
+	for name, compress := range tables {
+		t, err := newTable(dir, name, compress)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		f.tables[name] = t
+	}
+	if err := f.repair(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// repair 把所有表截断到共同的头尾，处理追加到一半时的崩溃
+func (f *Freezer) repair() error {
+	head, tail := f.Ancients(), f.Tail()
+	for _, t := range f.tables {
+		if err := t.truncateHead(head); err != nil {
+			return err
+		}
+		if err := t.truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// table 返回 kind 对应的表
+func (f *Freezer) table(kind string) (*table, error) {
+	t, ok := f.tables[kind]
+	if !ok {
+		return nil, fmt.Errorf("freezer: unknown table %s", kind)
+	}
+	return t, nil
+}
+
+// Ancients 返回所有表都已写入的条目数
+func (f *Freezer) Ancients() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var items uint64
+	first := true
+	for _, t := range f.tables {
+		if n := t.items(); first || n < items {
+			items, first = n, false
+		}
+	}
+	return items
+}
+
+// Tail 返回所有表都仍然保留的第一个条目序号
+func (f *Freezer) Tail() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	var tail uint64
+	for _, t := range f.tables {
+		if n := t.tailItem(); n > tail {
+			tail = n
+		}
+	}
+	return tail
+}
+
+// Append 向 kind 表追加序号为 number 的条目
+func (f *Freezer) Append(kind string, number uint64, item []byte) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	t, err := f.table(kind)
+	if err != nil {
+		return err
+	}
+	return t.append(number, item)
+}
+
+// Retrieve 读取 kind 表中序号为 number 的条目
+func (f *Freezer) Retrieve(kind string, number uint64) ([]byte, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	t, err := f.table(kind)
+	if err != nil {
+		return nil, err
+	}
+	return t.retrieve(number)
+}
+
+// TruncateHead 丢弃所有表中序号 >= items 的条目
+func (f *Freezer) TruncateHead(items uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, t := range f.tables {
+		if err := t.truncateHead(items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TruncateTail 丢弃所有表中序号 < tail 的条目
+func (f *Freezer) TruncateTail(tail uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, t := range f.tables {
+		if err := t.truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync 把所有表刷到磁盘
+func (f *Freezer) Sync() error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	for _, t := range f.tables {
+		if err := t.sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭所有表
+func (f *Freezer) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var err error
+	for _, t := range f.tables {
+		if cerr := t.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+package freezer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var testTables = map[string]bool{
+	"headers": false,
+	"bodies":  true,
+}
+
+func testItem(kind string, n uint64) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("%s-%d;", kind, n)), int(n%7)+1)
+}
+
+func TestFreezer(t *testing.T) {
+	dir := "testfreezer"
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, testTables)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+
+	for n := uint64(0); n < 10; n++ {
+		for kind := range testTables {
+			if err := f.Append(kind, n, testItem(kind, n)); err != nil {
+				t.Fatalf("Append %s %d failed: %v", kind, n, err)
+			}
+		}
+	}
+	if err := f.Append("headers", 5, nil); !errors.Is(err, ErrOutOfOrder) {
+		t.Errorf("Expected ErrOutOfOrder, got %v", err)
+	}
+	if f.Ancients() != 10 {
+		t.Errorf("Expected 10 ancients, got %d", f.Ancients())
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// 重新打开后数据仍然存在
+	f, err = NewFreezer(dir, testTables)
+	if err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+
+	for n := uint64(0); n < 10; n++ {
+		for kind := range testTables {
+			got, err := f.Retrieve(kind, n)
+			if err != nil {
+				t.Fatalf("Retrieve %s %d failed: %v", kind, n, err)
+			}
+			if !bytes.Equal(got, testItem(kind, n)) {
+				t.Errorf("Retrieve %s %d: want %s, got %s", kind, n, testItem(kind, n), got)
+			}
+		}
+	}
+
+	// 截断头部
+	if err := f.TruncateHead(8); err != nil {
+		t.Fatalf("TruncateHead failed: %v", err)
+	}
+	if f.Ancients() != 8 {
+		t.Errorf("Expected 8 ancients after TruncateHead, got %d", f.Ancients())
+	}
+	if _, err := f.Retrieve("headers", 8); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("Expected ErrOutOfBounds, got %v", err)
+	}
+
+	// 截断尾部
+	if err := f.TruncateTail(3); err != nil {
+		t.Fatalf("TruncateTail failed: %v", err)
+	}
+	if f.Tail() != 3 {
+		t.Errorf("Expected tail 3, got %d", f.Tail())
+	}
+	if _, err := f.Retrieve("bodies", 2); !errors.Is(err, ErrItemPruned) {
+		t.Errorf("Expected ErrItemPruned, got %v", err)
+	}
+	for n := uint64(3); n < 8; n++ {
+		got, err := f.Retrieve("bodies", n)
+		if err != nil {
+			t.Fatalf("Retrieve bodies %d after TruncateTail failed: %v", n, err)
+		}
+		if !bytes.Equal(got, testItem("bodies", n)) {
+			t.Errorf("Retrieve bodies %d: want %s, got %s", n, testItem("bodies", n), got)
+		}
+	}
+
+	// 截断后仍然可以继续追加
+	for kind := range testTables {
+		if err := f.Append(kind, 8, testItem(kind, 8)); err != nil {
+			t.Fatalf("Append %s after truncation failed: %v", kind, err)
+		}
+	}
+	if f.Ancients() != 9 {
+		t.Errorf("Expected 9 ancients, got %d", f.Ancients())
+	}
+}
+
+func TestFreezerRepair(t *testing.T) {
+	dir := "testfreezer_repair"
+	defer os.RemoveAll(dir)
+
+	f, err := NewFreezer(dir, testTables)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	for n := uint64(0); n < 5; n++ {
+		for kind := range testTables {
+			if err := f.Append(kind, n, testItem(kind, n)); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+		}
+	}
+	// 模拟崩溃：headers 表多写了一条
+	if err := f.Append("headers", 5, testItem("headers", 5)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	f.Close()
+
+	// 模拟崩溃：bodies 的数据文件只写了一半
+	ft := f.(*Freezer).tables["bodies"]
+	if err := os.Truncate(ft.dataPath(0), int64(ft.dataSize-1)); err != nil {
+		t.Fatalf("failed to truncate data file: %v", err)
+	}
+
+	f, err = NewFreezer(dir, testTables)
+	if err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer f.Close()
+
+	if f.Ancients() != 4 {
+		t.Fatalf("Expected 4 ancients after repair, got %d", f.Ancients())
+	}
+	if _, err := f.Retrieve("headers", 4); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("Expected headers to be aligned with bodies, got %v", err)
+	}
+	got, err := f.Retrieve("bodies", 3)
+	if err != nil || !bytes.Equal(got, testItem("bodies", 3)) {
+		t.Errorf("Retrieve bodies 3 after repair: got %s, %v", got, err)
+	}
+}
+
+func TestTableRemoveStale(t *testing.T) {
+	dir := "testfreezer_stale"
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	// 名字以另一张表的名字加点开头的表
+	a, err := newTable(dir, "a", false)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	defer a.Close()
+	ab, err := newTable(dir, "a.b", false)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	for n := uint64(0); n < 5; n++ {
+		if err := a.append(n, testItem("a", n)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		if err := ab.append(n, testItem("a.b", n)); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	ab.Close()
+
+	// 截断 a 的表尾不能删除 a.b 的数据文件
+	if err := a.truncateTail(2); err != nil {
+		t.Fatalf("truncateTail failed: %v", err)
+	}
+	if _, err := os.Stat(a.dataPath(0)); !os.IsNotExist(err) {
+		t.Errorf("Expected stale data file to be removed, got %v", err)
+	}
+	ab, err = newTable(dir, "a.b", false)
+	if err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	defer ab.Close()
+	for n := uint64(0); n < 5; n++ {
+		got, err := ab.retrieve(n)
+		if err != nil || !bytes.Equal(got, testItem("a.b", n)) {
+			t.Errorf("Retrieve a.b %d: got %s, %v", n, got, err)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package freezer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	indexHeaderSize = 8 // 索引文件头：保留的第一个条目的序号
+	indexEntrySize  = 8 // 每个索引项：条目在数据文件中的结束偏移
+)
+
+var (
+	ErrOutOfOrder  = errors.New("freezer: append out of order")
+	ErrOutOfBounds = errors.New("freezer: item out of bounds")
+	ErrItemPruned  = errors.New("freezer: item already pruned")
+	ErrClosed      = errors.New("freezer: table closed")
+)
+
+// table 是一张只追加的平面文件表，由一个定长索引文件和一个数据文件组成。
+//
+// 索引文件布局：
+//
+//	[tail uint64][end offset of item tail][end offset of item tail+1]...
+//
+// 条目 tail+i 的数据位于数据文件的 [end(i-1), end(i)) 区间，end(-1) 为 0。
+type table struct {
+	lock     sync.RWMutex
+	dir      string
+	name     string
+	compress bool
+
+	index *os.File
+	data  *os.File
+
+	tail     uint64 // 保留的第一个条目的序号
+	head     uint64 // 下一个要追加的条目序号
+	dataSize uint64 // 数据文件的有效长度
+}
+
+// newTable 打开或创建一张表，并修复崩溃时写了一半的数据
+func newTable(dir, name string, compress bool) (*table, error) {
+	t := &table{dir: dir, name: name, compress: compress}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *table) indexPath() string {
+	return filepath.Join(t.dir, t.name+".idx")
+}
+
+// dataPath 返回以 tail 开头的数据文件路径。数据文件名中带上 tail，
+// 截断表尾时写入新文件，再原子地替换索引文件来切换，避免崩溃后新旧文件错配
+func (t *table) dataPath(tail uint64) string {
+	ext := "rdat"
+	if t.compress {
+		ext = "cdat"
+	}
+	return filepath.Join(t.dir, fmt.Sprintf("%s.%d.%s", t.name, tail, ext))
+}
+
+// open 打开索引和数据文件，按照索引修复两个文件的长度
+func (t *table) open() error {
+	index, err := os.OpenFile(t.indexPath(), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	t.index = index
+	if err := t.readHeader(); err != nil {
+		t.close()
+		return err
+	}
+	data, err := os.OpenFile(t.dataPath(t.tail), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.close()
+		return err
+	}
+	t.data = data
+	if err := t.removeStale(); err != nil {
+		t.close()
+		return err
+	}
+	if err := t.repair(); err != nil {
+		t.close()
+		return err
+	}
+	return nil
+}
+
+// readHeader 读取索引文件头中的 tail，新表则写入表头
+func (t *table) readHeader() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() < indexHeaderSize {
+		if err := t.index.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := t.index.WriteAt(make([]byte, indexHeaderSize), 0); err != nil {
+			return err
+		}
+	}
+	var header [indexHeaderSize]byte
+	if _, err := t.index.ReadAt(header[:], 0); err != nil {
+		return err
+	}
+	t.tail = binary.BigEndian.Uint64(header[:])
+	return nil
+}
+
+// removeStale 删除截断表尾时遗留的、不再被索引引用的数据文件。
+// 只删除文件名恰好是 <name>.<tail>.<ext> 的文件，名字以 <name>. 开头的其他表不受影响
+func (t *table) removeStale() error {
+	ext := "rdat"
+	if t.compress {
+		ext = "cdat"
+	}
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		number, ok := strings.CutPrefix(entry.Name(), t.name+".")
+		if !ok {
+			continue
+		}
+		if number, ok = strings.CutSuffix(number, "."+ext); !ok {
+			continue
+		}
+		tail, err := strconv.ParseUint(number, 10, 64)
+		if err != nil || tail == t.tail {
+			continue
+		}
+		if err := os.Remove(filepath.Join(t.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repair 丢弃索引中不完整的项以及数据文件中没有索引的尾部数据
+func (t *table) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	entries := uint64(stat.Size()-indexHeaderSize) / indexEntrySize
+
+	stat, err = t.data.Stat()
+	if err != nil {
+		return err
+	}
+	dataSize := uint64(stat.Size())
+
+	// 从后往前找到第一个数据完整写入的索引项
+	for entries > 0 {
+		end, err := t.readEntry(entries - 1)
+		if err != nil {
+			return err
+		}
+		if end <= dataSize {
+			break
+		}
+		entries--
+	}
+	t.dataSize = 0
+	if entries > 0 {
+		if t.dataSize, err = t.readEntry(entries - 1); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Truncate(indexHeaderSize + int64(entries)*indexEntrySize); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(t.dataSize)); err != nil {
+		return err
+	}
+	t.head = t.tail + entries
+	return nil
+}
+
+// readEntry 读取第 i 个索引项（相对于 tail）
+func (t *table) readEntry(i uint64) (uint64, error) {
+	var buf [indexEntrySize]byte
+	if _, err := t.index.ReadAt(buf[:], int64(indexHeaderSize+i*indexEntrySize)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// items 返回表中下一个要追加的条目序号
+func (t *table) items() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.head
+}
+
+// tailItem 返回表中保留的第一个条目序号
+func (t *table) tailItem() uint64 {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.tail
+}
+
+// append 追加一个条目，先写数据再写索引，保证崩溃后可以修复
+func (t *table) append(number uint64, item []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return ErrClosed
+	}
+	if number != t.head {
+		return fmt.Errorf("%w: table %s has %d items, got %d", ErrOutOfOrder, t.name, t.head, number)
+	}
+	if t.compress {
+		item = snappy.Encode(nil, item)
+	}
+	if _, err := t.data.WriteAt(item, int64(t.dataSize)); err != nil {
+		return err
+	}
+	end := t.dataSize + uint64(len(item))
+
+	var buf [indexEntrySize]byte
+	binary.BigEndian.PutUint64(buf[:], end)
+	if _, err := t.index.WriteAt(buf[:], int64(indexHeaderSize+(t.head-t.tail)*indexEntrySize)); err != nil {
+		return err
+	}
+	t.dataSize = end
+	t.head++
+	return nil
+}
+
+// retrieve 读取序号为 number 的条目
+func (t *table) retrieve(number uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, ErrClosed
+	}
+	if number < t.tail {
+		return nil, ErrItemPruned
+	}
+	if number >= t.head {
+		return nil, ErrOutOfBounds
+	}
+	start, end, err := t.bounds(number - t.tail)
+	if err != nil {
+		return nil, err
+	}
+	item := make([]byte, end-start)
+	if _, err := t.data.ReadAt(item, int64(start)); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if t.compress {
+		return snappy.Decode(nil, item)
+	}
+	return item, nil
+}
+
+// bounds 返回第 i 个条目（相对于 tail）在数据文件中的起止偏移
+func (t *table) bounds(i uint64) (uint64, uint64, error) {
+	end, err := t.readEntry(i)
+	if err != nil {
+		return 0, 0, err
+	}
+	if i == 0 {
+		return 0, end, nil
+	}
+	start, err := t.readEntry(i - 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// truncateHead 丢弃序号 >= items 的条目
+func (t *table) truncateHead(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return ErrClosed
+	}
+	if items >= t.head {
+		return nil
+	}
+	if items < t.tail {
+		items = t.tail
+	}
+	var end uint64
+	if items > t.tail {
+		var err error
+		if end, err = t.readEntry(items - t.tail - 1); err != nil {
+			return err
+		}
+	}
+	if err := t.index.Truncate(int64(indexHeaderSize + (items-t.tail)*indexEntrySize)); err != nil {
+		return err
+	}
+	if err := t.data.Truncate(int64(end)); err != nil {
+		return err
+	}
+	t.head = items
+	t.dataSize = end
+	return nil
+}
+
+// truncateTail 丢弃序号 < tail 的条目。剩余的数据会被复制到新文件中，
+// 再原子地替换旧文件，因此耗时与保留的数据量成正比
+func (t *table) truncateTail(tail uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return ErrClosed
+	}
+	if tail <= t.tail {
+		return nil
+	}
+	if tail > t.head {
+		tail = t.head
+	}
+	var offset uint64
+	if tail > t.tail {
+		var err error
+		if offset, err = t.readEntry(tail - t.tail - 1); err != nil {
+			return err
+		}
+	}
+
+	// 把保留的数据写入以新 tail 命名的数据文件
+	data, err := os.Create(t.dataPath(tail))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(data, io.NewSectionReader(t.data, int64(offset), int64(t.dataSize-offset))); err != nil {
+		data.Close()
+		return err
+	}
+	if err := data.Sync(); err != nil {
+		data.Close()
+		return err
+	}
+	data.Close()
+
+	// 写入新的索引文件，所有偏移都减去被丢弃的数据长度
+	tmpIndex := t.indexPath() + ".tmp"
+	index, err := os.Create(tmpIndex)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, indexHeaderSize, indexHeaderSize+(t.head-tail)*indexEntrySize)
+	binary.BigEndian.PutUint64(buf, tail)
+	for n := tail; n < t.head; n++ {
+		end, err := t.readEntry(n - t.tail)
+		if err != nil {
+			index.Close()
+			return err
+		}
+		buf = binary.BigEndian.AppendUint64(buf, end-offset)
+	}
+	if _, err := index.Write(buf); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Sync(); err != nil {
+		index.Close()
+		return err
+	}
+	index.Close()
+
+	// 替换索引文件是切换点：之前崩溃则继续使用旧文件，之后崩溃则使用新文件，
+	// 未被引用的数据文件在下次打开时删除
+	t.close()
+	if err := os.Rename(tmpIndex, t.indexPath()); err != nil {
+		return err
+	}
+	return t.open()
+}
+
+// sync 把索引和数据刷到磁盘
+func (t *table) sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return ErrClosed
+	}
+	if err := t.data.Sync(); err != nil {
+		return err
+	}
+	return t.index.Sync()
+}
+
+// Close 关闭表文件
+func (t *table) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.close()
+}
+
+func (t *table) close() error {
+	if t.index == nil {
+		return nil
+	}
+	err := t.index.Close()
+	if derr := t.data.Close(); err == nil {
+		err = derr
+	}
+	t.index, t.data = nil, nil
+	return err
+}
@@ -1,9 +1,13 @@
 package kvstore
 
 import (
+	"errors"
 	"io"
 )
 
+// ErrNotFound 表示要读取的键不存在
+var ErrNotFound = errors.New("kvstore: not found")
+
 // KVStore 定义了键值存储的接口
 type KVStore interface {
 	// 基本操作
@@ -19,6 +23,9 @@ type KVStore interface {
 	// 迭代器
 	NewIterator(prefix []byte) Iterator
 
+	// 乐观事务
+	Begin() Transaction
+
 	// 关闭存储
 	io.Closer
 }
@@ -31,6 +38,16 @@ type Batch interface {
 	Len() int
 }
 
+// Transaction 定义了乐观事务的接口。事务内的写入在 Commit 前只对自己可见，
+// Commit 时如果事务读过的键已被其他写入修改，返回 ErrTxConflict 且不写入任何数据
+type Transaction interface {
+	Get(key []byte) ([]byte, error)
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+	Commit() error
+	Rollback()
+}
+
 // Iterator 定义了迭代器的接口
 type Iterator interface {
 	Next() bool
@@ -39,3 +56,54 @@ type Iterator interface {
 	Error() error
 	Release()
 }
+
+// Compacter 是可选接口，支持手动压缩与统计信息的存储引擎可以实现它，
+// 调用方通过类型断言使用
+type Compacter interface {
+	// Compact 压缩 [start, limit) 范围内的数据，nil 表示不限边界
+	Compact(start []byte, limit []byte) error
+	// DiskSize 返回 [start, limit) 范围内数据在磁盘上的近似大小（字节）
+	DiskSize(start []byte, limit []byte) (int64, error)
+	// Stat 返回存储引擎内部的统计信息
+	Stat() (*Stats, error)
+}
+
+// Stats 存储引擎的内部统计信息
+type Stats struct {
+	LevelSizes  []int64 // 每一层的数据大小
+	LevelTables []int   // 每一层的表文件数量
+	LevelRead   []int64 // 每一层压缩时读取的字节数
+	LevelWrite  []int64 // 每一层压缩时写入的字节数
+
+	MemCompactions       uint32 // 内存表落盘次数
+	Level0Compactions    uint32 // 第0层压缩次数
+	NonLevel0Compactions uint32 // 其余层压缩次数
+	SeekCompactions      uint32 // 由查找触发的压缩次数
+
+	IORead  uint64 // 累计读取的字节数
+	IOWrite uint64 // 累计写入的字节数
+}
+
+// AncientStore 定义了只追加的冷数据存储接口，用来保存区块、收据等
+// 已经确定、不会再修改的历史数据，使它们不再占用 KVStore 的压缩开销。
+// 每一类数据（kind）各自是一张按序号连续编号的表。
+type AncientStore interface {
+	// Ancients 返回所有表都已冻结的条目数，即下一个要追加的序号
+	Ancients() uint64
+	// Tail 返回仍然保留的第一个条目的序号
+	Tail() uint64
+
+	// Append 向 kind 表追加序号为 number 的条目，number 必须等于该表当前的条目数
+	Append(kind string, number uint64, item []byte) error
+	// Retrieve 读取 kind 表中序号为 number 的条目
+	Retrieve(kind string, number uint64) ([]byte, error)
+
+	// TruncateHead 丢弃序号 >= items 的条目
+	TruncateHead(items uint64) error
+	// TruncateTail 丢弃序号 < tail 的条目
+	TruncateTail(tail uint64) error
+
+	// Sync 把所有数据刷到磁盘
+	Sync() error
+	io.Closer
+}
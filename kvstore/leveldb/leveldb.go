@@ -9,31 +9,45 @@ import (
 
 // LevelDB 实现了KVStore接口
 type LevelDB struct {
-	db *leveldb.DB
+	db  *leveldb.DB
+	txs *kvstore.TxTracker
 }
 
 // NewLevelDB 创建一个新的LevelDB实例
 func NewLevelDB(path string) (kvstore.KVStore, error) {
-	db, err := leveldb.OpenFile(path, nil)
+	return NewLevelDBWithOptions(path, nil)
+}
+
+// NewLevelDBWithOptions 按给定参数打开LevelDB，options 为 nil 时使用默认参数
+func NewLevelDBWithOptions(path string, options *Options) (kvstore.KVStore, error) {
+	db, err := leveldb.OpenFile(path, options.toLevelDB())
 	if err != nil {
 		return nil, err
 	}
-	return &LevelDB{db: db}, nil
+	return &LevelDB{db: db, txs: kvstore.NewTxTracker()}, nil
 }
 
-// Get 获取指定键的值
+// Get 获取指定键的值，键不存在时返回 kvstore.ErrNotFound
 func (l *LevelDB) Get(key []byte) ([]byte, error) {
-	return l.db.Get(key, nil)
+	value, err := l.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, kvstore.ErrNotFound
+	}
+	return value, err
 }
 
 // Put 存储键值对
 func (l *LevelDB) Put(key, value []byte) error {
-	return l.db.Put(key, value, nil)
+	return l.txs.Update([][]byte{key}, func() error {
+		return l.db.Put(key, value, nil)
+	})
 }
 
 // Delete 删除指定键
 func (l *LevelDB) Delete(key []byte) error {
-	return l.db.Delete(key, nil)
+	return l.txs.Update([][]byte{key}, func() error {
+		return l.db.Delete(key, nil)
+	})
 }
 
 // Has 检查键是否存在
@@ -50,6 +64,17 @@ func (l *LevelDB) Batch() kvstore.Batch {
 
 // Write 执行批量操作
 func (l *LevelDB) Write(batch kvstore.Batch) error {
+	b, ok := batch.(*levelDBBatch)
+	if !ok {
+		return nil
+	}
+	return l.txs.Update(b.keys, func() error {
+		return l.write(b)
+	})
+}
+
+// write 直接写入批次，不经过事务记录
+func (l *LevelDB) write(batch kvstore.Batch) error {
 	b, ok := batch.(*levelDBBatch)
 	if !ok {
 		return nil
@@ -57,32 +82,88 @@ func (l *LevelDB) Write(batch kvstore.Batch) error {
 	return l.db.Write(b.batch, nil)
 }
 
+// Begin 开启一个乐观事务
+func (l *LevelDB) Begin() kvstore.Transaction {
+	return l.txs.Begin(l, l.write)
+}
+
 // NewIterator 创建新的迭代器
 func (l *LevelDB) NewIterator(prefix []byte) kvstore.Iterator {
 	iter := l.db.NewIterator(util.BytesPrefix(prefix), nil)
 	return &levelDBIterator{iter: iter}
 }
 
+// Compact 手动压缩 [start, limit) 范围内的数据
+func (l *LevelDB) Compact(start []byte, limit []byte) error {
+	return l.db.CompactRange(util.Range{Start: start, Limit: limit})
+}
+
+// DiskSize 返回 [start, limit) 范围内数据在磁盘上的近似大小，
+// 尚未落盘的内存表数据不计算在内
+func (l *LevelDB) DiskSize(start []byte, limit []byte) (int64, error) {
+	if limit != nil {
+		sizes, err := l.db.SizeOf([]util.Range{{Start: start, Limit: limit}})
+		if err != nil {
+			return 0, err
+		}
+		return sizes.Sum(), nil
+	}
+	// goleveldb 把 nil 上界当成最小的键，这里用总大小减去 start 之前的部分
+	var stats leveldb.DBStats
+	if err := l.db.Stats(&stats); err != nil {
+		return 0, err
+	}
+	before, err := l.db.SizeOf([]util.Range{{Start: nil, Limit: start}})
+	if err != nil {
+		return 0, err
+	}
+	return stats.LevelSizes.Sum() - before.Sum(), nil
+}
+
+// Stat 返回LevelDB内部的层级、压缩和IO统计
+func (l *LevelDB) Stat() (*kvstore.Stats, error) {
+	var stats leveldb.DBStats
+	if err := l.db.Stats(&stats); err != nil {
+		return nil, err
+	}
+	return &kvstore.Stats{
+		LevelSizes:           stats.LevelSizes,
+		LevelTables:          stats.LevelTablesCounts,
+		LevelRead:            stats.LevelRead,
+		LevelWrite:           stats.LevelWrite,
+		MemCompactions:       stats.MemComp,
+		Level0Compactions:    stats.Level0Comp,
+		NonLevel0Compactions: stats.NonLevel0Comp,
+		SeekCompactions:      stats.SeekComp,
+		IORead:               stats.IORead,
+		IOWrite:              stats.IOWrite,
+	}, nil
+}
+
 // Close 关闭数据库连接
 func (l *LevelDB) Close() error {
 	return l.db.Close()
 }
 
-// levelDBBatch 实现了Batch接口
+// levelDBBatch 实现了Batch接口，同时记录修改过的键供事务冲突检测使用
 type levelDBBatch struct {
 	batch *leveldb.Batch
+	keys  [][]byte
 }
 
 func (b *levelDBBatch) Put(key, value []byte) {
 	b.batch.Put(key, value)
+	b.keys = append(b.keys, append([]byte{}, key...))
 }
 
 func (b *levelDBBatch) Delete(key []byte) {
 	b.batch.Delete(key)
+	b.keys = append(b.keys, append([]byte{}, key...))
 }
 
 func (b *levelDBBatch) Reset() {
 	b.batch.Reset()
+	b.keys = b.keys[:0]
 }
 
 func (b *levelDBBatch) Len() int {
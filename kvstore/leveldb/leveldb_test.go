@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"testing"
+
+	"hyblockchain/kvstore"
 )
 
 func BenchmarkLevelDB_Put(b *testing.B) {
@@ -52,3 +54,123 @@ func BenchmarkLevelDB_Get(b *testing.B) {
 		}
 	}
 }
+
+func TestLevelDBReadOnly(t *testing.T) {
+	dbPath := "testdb_readonly"
+	defer os.RemoveAll(dbPath)
+
+	db, err := NewLevelDBWithOptions(dbPath, &Options{
+		Cache:       16,
+		Handles:     64,
+		WriteBuffer: 8,
+		Compression: NoCompression,
+	})
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	if err := db.Put([]byte("hello"), []byte("world")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// 写入方持有文件锁时不能以只读方式打开
+	if ro, err := NewLevelDBWithOptions(dbPath, &Options{ReadOnly: true}); err == nil {
+		ro.Close()
+		t.Errorf("Expected read-only open to fail while the database is held")
+	}
+	db.Close()
+
+	ro, err := NewLevelDBWithOptions(dbPath, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to open leveldb read-only: %v", err)
+	}
+	defer ro.Close()
+
+	got, err := ro.Get([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if string(got) != "world" {
+		t.Errorf("Expected world, got %s", got)
+	}
+	if err := ro.Put([]byte("hello"), []byte("again")); err == nil {
+		t.Errorf("Expected Put to fail on read-only db")
+	}
+}
+
+func TestLevelDBCompactAndStat(t *testing.T) {
+	dbPath := "testdb_compact"
+	defer os.RemoveAll(dbPath)
+
+	db, err := NewLevelDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%04d", i))
+		if err := db.Put(key, make([]byte, 100)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	c, ok := db.(kvstore.Compacter)
+	if !ok {
+		t.Fatalf("LevelDB should implement kvstore.Compacter")
+	}
+	if err := c.Compact(nil, nil); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	size, err := c.DiskSize(nil, nil)
+	if err != nil {
+		t.Fatalf("DiskSize failed: %v", err)
+	}
+	if size <= 0 {
+		t.Errorf("Expected positive disk size after compaction, got %d", size)
+	}
+
+	stats, err := c.Stat()
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if stats.MemCompactions == 0 {
+		t.Errorf("Expected at least one memtable compaction")
+	}
+	if stats.IOWrite == 0 {
+		t.Errorf("Expected IOWrite to be non-zero")
+	}
+}
+
+func TestLevelDBTransaction(t *testing.T) {
+	dbPath := "testdb_txn"
+	defer os.RemoveAll(dbPath)
+
+	db, err := NewLevelDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("balance"), []byte("100"))
+
+	tx1 := db.Begin()
+	tx2 := db.Begin()
+	tx1.Get([]byte("balance"))
+	tx2.Get([]byte("balance"))
+	tx1.Put([]byte("balance"), []byte("90"))
+	tx2.Put([]byte("balance"), []byte("80"))
+
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1 Commit failed: %v", err)
+	}
+	if err := tx2.Commit(); err != kvstore.ErrTxConflict {
+		t.Fatalf("Expected ErrTxConflict, got %v", err)
+	}
+	got, err := db.Get([]byte("balance"))
+	if err != nil || string(got) != "90" {
+		t.Errorf("Expected balance 90, got %s, %v", got, err)
+	}
+	if _, err := db.Get([]byte("missing")); err != kvstore.ErrNotFound {
+		t.Errorf("Expected kvstore.ErrNotFound, got %v", err)
+	}
+}
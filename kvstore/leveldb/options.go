@@ -0,0 +1,45 @@
+package leveldb
+
+import (
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Compression 表示 LevelDB 数据块使用的压缩算法
+type Compression int
+
+const (
+	DefaultCompression Compression = iota // 使用 goleveldb 默认配置（snappy）
+	NoCompression                         // 不压缩
+	SnappyCompression                     // snappy 压缩
+)
+
+// Options 是打开 LevelDB 时可调节的参数，零值表示使用 goleveldb 的默认值
+type Options struct {
+	Cache       int         // 块缓存大小，单位 MB
+	Handles     int         // 最多同时打开的文件句柄数
+	WriteBuffer int         // 内存写缓冲大小，单位 MB
+	Compression Compression // 数据块压缩算法
+	ReadOnly    bool        // 以只读方式打开，数据库被其他实例打开时会失败
+}
+
+// toLevelDB 把 Options 转换成 goleveldb 的参数
+func (o *Options) toLevelDB() *opt.Options {
+	if o == nil {
+		return nil
+	}
+	options := &opt.Options{
+		BlockCacheCapacity:     o.Cache * opt.MiB,
+		OpenFilesCacheCapacity: o.Handles,
+		WriteBuffer:            o.WriteBuffer * opt.MiB,
+		ReadOnly:               o.ReadOnly,
+	}
+	switch o.Compression {
+	case NoCompression:
+		options.Compression = opt.NoCompression
+	case SnappyCompression:
+		options.Compression = opt.SnappyCompression
+	default:
+		options.Compression = opt.DefaultCompression
+	}
+	return options
+}
@@ -0,0 +1,233 @@
+package memorydb
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"hyblockchain/kvstore"
+)
+
+var errMemoryDBClosed = errors.New("memorydb: database closed")
+
+// MemoryDB 是一个基于 map 的内存 KVStore 实现，主要用于测试和临时数据
+type MemoryDB struct {
+	lock sync.RWMutex
+	db   map[string][]byte
+	txs  *kvstore.TxTracker
+}
+
+// NewMemoryDB 创建一个新的内存数据库
+func NewMemoryDB() kvstore.KVStore {
+	return &MemoryDB{
+		db:  make(map[string][]byte),
+		txs: kvstore.NewTxTracker(),
+	}
+}
+
+// Get 获取指定键的值，键不存在时返回 kvstore.ErrNotFound
+func (m *MemoryDB) Get(key []byte) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.db == nil {
+		return nil, errMemoryDBClosed
+	}
+	value, ok := m.db[string(key)]
+	if !ok {
+		return nil, kvstore.ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Put 存储键值对
+func (m *MemoryDB) Put(key []byte, value []byte) error {
+	return m.txs.Update([][]byte{key}, func() error {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		if m.db == nil {
+			return errMemoryDBClosed
+		}
+		m.db[string(key)] = append([]byte{}, value...)
+		return nil
+	})
+}
+
+// Delete 删除指定键
+func (m *MemoryDB) Delete(key []byte) error {
+	return m.txs.Update([][]byte{key}, func() error {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		if m.db == nil {
+			return errMemoryDBClosed
+		}
+		delete(m.db, string(key))
+		return nil
+	})
+}
+
+// Has 检查键是否存在
+func (m *MemoryDB) Has(key []byte) (bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if m.db == nil {
+		return false, errMemoryDBClosed
+	}
+	_, ok := m.db[string(key)]
+	return ok, nil
+}
+
+// Batch 创建新的批量操作
+func (m *MemoryDB) Batch() kvstore.Batch {
+	return &memoryBatch{}
+}
+
+// Write 执行批量操作
+func (m *MemoryDB) Write(batch kvstore.Batch) error {
+	b, ok := batch.(*memoryBatch)
+	if !ok {
+		return errors.New("memorydb: batch was not created by MemoryDB")
+	}
+	keys := make([][]byte, len(b.writes))
+	for i, w := range b.writes {
+		keys[i] = w.key
+	}
+	return m.txs.Update(keys, func() error {
+		return m.write(b)
+	})
+}
+
+// write 直接写入批次，不经过事务记录
+func (m *MemoryDB) write(batch kvstore.Batch) error {
+	b, ok := batch.(*memoryBatch)
+	if !ok {
+		return errors.New("memorydb: batch was not created by MemoryDB")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.db == nil {
+		return errMemoryDBClosed
+	}
+	for _, w := range b.writes {
+		if w.delete {
+			delete(m.db, string(w.key))
+		} else {
+			m.db[string(w.key)] = w.value
+		}
+	}
+	return nil
+}
+
+// NewIterator 创建新的迭代器，迭代创建时刻以 prefix 开头的数据快照，按键排序
+func (m *MemoryDB) NewIterator(prefix []byte) kvstore.Iterator {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	var keys []string
+	for key := range m.db {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = m.db[key]
+	}
+	return &memoryIterator{keys: keys, values: values, index: -1}
+}
+
+// Begin 开启一个乐观事务
+func (m *MemoryDB) Begin() kvstore.Transaction {
+	return m.txs.Begin(m, m.write)
+}
+
+// Close 关闭数据库并释放数据
+func (m *MemoryDB) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.db = nil
+	return nil
+}
+
+// Len 返回数据库中的键值对数量
+func (m *MemoryDB) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return len(m.db)
+}
+
+// memoryWrite 是批次中的一次写入或删除
+type memoryWrite struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// memoryBatch 实现了Batch接口
+type memoryBatch struct {
+	writes []memoryWrite
+}
+
+func (b *memoryBatch) Put(key, value []byte) {
+	b.writes = append(b.writes, memoryWrite{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	})
+}
+
+func (b *memoryBatch) Delete(key []byte) {
+	b.writes = append(b.writes, memoryWrite{key: append([]byte{}, key...), delete: true})
+}
+
+func (b *memoryBatch) Reset() {
+	b.writes = b.writes[:0]
+}
+
+func (b *memoryBatch) Len() int {
+	return len(b.writes)
+}
+
+// memoryIterator 实现了Iterator接口
+type memoryIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+}
+
+func (i *memoryIterator) Next() bool {
+	if i.index >= len(i.keys) {
+		return false
+	}
+	i.index++
+	return i.index < len(i.keys)
+}
+
+func (i *memoryIterator) Key() []byte {
+	if i.index < 0 || i.index >= len(i.keys) {
+		return nil
+	}
+	return []byte(i.keys[i.index])
+}
+
+func (i *memoryIterator) Value() []byte {
+	if i.index < 0 || i.index >= len(i.keys) {
+		return nil
+	}
+	return i.values[i.index]
+}
+
+func (i *memoryIterator) Error() error {
+	return nil
+}
+
+func (i *memoryIterator) Release() {
+	i.keys, i.values = nil, nil
+}
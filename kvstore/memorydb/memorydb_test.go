@@ -0,0 +1,157 @@
+package memorydb
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"hyblockchain/kvstore"
+)
+
+func TestMemoryDB(t *testing.T) {
+	db := NewMemoryDB()
+	defer db.Close()
+
+	if err := db.Put([]byte("key1"), []byte("value1")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	batch := db.Batch()
+	batch.Put([]byte("key2"), []byte("value2"))
+	batch.Put([]byte("key3"), []byte("value3"))
+	batch.Delete([]byte("key1"))
+	if err := db.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if _, err := db.Get([]byte("key1")); !errors.Is(err, kvstore.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for deleted key, got %v", err)
+	}
+
+	iter := db.NewIterator([]byte("key"))
+	defer iter.Release()
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	if len(keys) != 2 || keys[0] != "key2" || keys[1] != "key3" {
+		t.Errorf("Unexpected iteration result: %v", keys)
+	}
+}
+
+func TestMemoryDBTransaction(t *testing.T) {
+	db := NewMemoryDB()
+	defer db.Close()
+
+	db.Put([]byte("a"), []byte("1"))
+	db.Put([]byte("b"), []byte("2"))
+
+	// 事务内可以读到自己的写入，提交前对外不可见
+	tx := db.Begin()
+	if v, _ := tx.Get([]byte("a")); string(v) != "1" {
+		t.Fatalf("Expected a=1 in transaction, got %s", v)
+	}
+	tx.Put([]byte("a"), []byte("10"))
+	tx.Delete([]byte("b"))
+	if v, _ := tx.Get([]byte("a")); string(v) != "10" {
+		t.Errorf("Expected to read own write, got %s", v)
+	}
+	if _, err := tx.Get([]byte("b")); !errors.Is(err, kvstore.ErrNotFound) {
+		t.Errorf("Expected deleted key to be missing in transaction, got %v", err)
+	}
+	if v, _ := db.Get([]byte("a")); string(v) != "1" {
+		t.Errorf("Uncommitted write should not be visible, got %s", v)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if v, _ := db.Get([]byte("a")); string(v) != "10" {
+		t.Errorf("Expected committed value 10, got %s", v)
+	}
+	if err := tx.Commit(); !errors.Is(err, kvstore.ErrTxDone) {
+		t.Errorf("Expected ErrTxDone on second commit, got %v", err)
+	}
+
+	// 读过的键被其他写入修改后提交失败
+	tx1 := db.Begin()
+	tx2 := db.Begin()
+	tx1.Get([]byte("a"))
+	tx1.Put([]byte("a"), []byte("11"))
+	tx2.Get([]byte("a"))
+	tx2.Put([]byte("a"), []byte("12"))
+	if err := tx1.Commit(); err != nil {
+		t.Fatalf("tx1 Commit failed: %v", err)
+	}
+	if err := tx2.Commit(); !errors.Is(err, kvstore.ErrTxConflict) {
+		t.Fatalf("Expected ErrTxConflict, got %v", err)
+	}
+	if v, _ := db.Get([]byte("a")); string(v) != "11" {
+		t.Errorf("Conflicting transaction must not write, got %s", v)
+	}
+
+	// 非事务写入同样会触发冲突
+	tx3 := db.Begin()
+	tx3.Get([]byte("a"))
+	db.Put([]byte("a"), []byte("13"))
+	tx3.Put([]byte("c"), []byte("3"))
+	if err := tx3.Commit(); !errors.Is(err, kvstore.ErrTxConflict) {
+		t.Fatalf("Expected ErrTxConflict after direct Put, got %v", err)
+	}
+
+	// 回滚后不写入
+	tx4 := db.Begin()
+	tx4.Put([]byte("d"), []byte("4"))
+	tx4.Rollback()
+	if has, _ := db.Has([]byte("d")); has {
+		t.Errorf("Rolled back write should not be visible")
+	}
+}
+
+func TestMemoryDBTransactionConcurrentWrites(t *testing.T) {
+	db := NewMemoryDB()
+	defer db.Close()
+
+	// 事务递增计数器，同时有大量不在事务中的写入，事务的更新不能丢失
+	const workers, increments = 4, 50
+	db.Put([]byte("counter"), []byte("0"))
+	stop := make(chan struct{})
+	var writers, txs sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			key := []byte("w" + strconv.Itoa(i))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					db.Put(key, key)
+				}
+			}
+		}(i)
+		txs.Add(1)
+		go func() {
+			defer txs.Done()
+			for n := 0; n < increments; {
+				tx := db.Begin()
+				v, _ := tx.Get([]byte("counter"))
+				count, _ := strconv.Atoi(string(v))
+				tx.Put([]byte("counter"), []byte(strconv.Itoa(count+1)))
+				if err := tx.Commit(); err == nil {
+					n++
+				} else if !errors.Is(err, kvstore.ErrTxConflict) {
+					t.Errorf("Commit failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	txs.Wait()
+	close(stop)
+	writers.Wait()
+
+	if v, _ := db.Get([]byte("counter")); string(v) != strconv.Itoa(workers*increments) {
+		t.Errorf("Expected counter %d, got %s", workers*increments, v)
+	}
+}
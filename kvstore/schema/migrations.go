@@ -0,0 +1,39 @@
+package schema
+
+import "hyblockchain/kvstore"
+
+// migrations 是本仓库持久化布局的变更记录。修改 MPT 节点序列化格式、
+// 增加新的键前缀等任何会影响已有数据的改动，都要在末尾追加一条迁移
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "record schema version",
+		Apply:   func(kvstore.KVStore) error { return nil },
+	},
+	{
+		// 节点改为可解码的编码以支持从根哈希重新打开 MPT，
+		// 旧节点无法还原出树结构，只能重建数据目录
+		Version: 2,
+		Name:    "mpt node encoding v2",
+		Apply:   func(kvstore.KVStore) error { return ErrIncompatible },
+	},
+}
+
+// Default 是包含本仓库全部迁移的注册表，迁移编号有误时在初始化时 panic
+var Default = func() *Registry {
+	r, err := NewRegistry(migrations...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}()
+
+// Migrate 用默认注册表检查并升级 db，应在打开数据库后、使用之前调用
+func Migrate(db kvstore.KVStore) error {
+	return Default.Migrate(db)
+}
+
+// Check 用默认注册表检查 db 的版本，不写入数据，用于只读打开
+func Check(db kvstore.KVStore) error {
+	return Default.Check(db)
+}
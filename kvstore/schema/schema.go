@@ -0,0 +1,137 @@
+package schema
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"hyblockchain/kvstore"
+)
+
+// versionKey 保存数据目录的布局版本号
+var versionKey = []byte("schema-version")
+
+var (
+	ErrTooNew         = errors.New("schema: database was written by a newer version")
+	ErrBadVersion     = errors.New("schema: malformed schema version")
+	ErrBadMigrationID = errors.New("schema: migrations must be numbered 1, 2, 3...")
+	ErrIncompatible   = errors.New("schema: data cannot be upgraded in place, rebuild the data directory")
+	ErrOutdated       = errors.New("schema: database needs migration, open it read-write first")
+)
+
+// Migration 把数据库从 Version-1 版本升级到 Version 版本。
+// 升级完成后才会写入新的版本号，如果中途崩溃下次启动会重新执行，
+// 所以 Apply 必须可以重复执行
+type Migration struct {
+	Version uint64
+	Name    string
+	Apply   func(db kvstore.KVStore) error
+}
+
+// Registry 是按版本顺序排列的迁移函数集合
+type Registry struct {
+	migrations []Migration
+}
+
+// NewRegistry 创建迁移注册表，迁移必须从 1 开始连续编号
+func NewRegistry(migrations ...Migration) (*Registry, error) {
+	for i, m := range migrations {
+		if m.Version != uint64(i+1) {
+			return nil, fmt.Errorf("%w: got %d at position %d", ErrBadMigrationID, m.Version, i)
+		}
+	}
+	return &Registry{migrations: migrations}, nil
+}
+
+// Latest 返回当前程序支持的最新版本
+func (r *Registry) Latest() uint64 {
+	return uint64(len(r.migrations))
+}
+
+// ReadVersion 读取数据库的布局版本，没有记录时返回 ok=false
+func ReadVersion(db kvstore.KVStore) (version uint64, ok bool, err error) {
+	has, err := db.Has(versionKey)
+	if err != nil || !has {
+		return 0, false, err
+	}
+	data, err := db.Get(versionKey)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(data) != 8 {
+		return 0, false, ErrBadVersion
+	}
+	return binary.BigEndian.Uint64(data), true, nil
+}
+
+// WriteVersion 写入数据库的布局版本
+func WriteVersion(db kvstore.KVStore, version uint64) error {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], version)
+	return db.Put(versionKey, data[:])
+}
+
+// Migrate 在启动时检查并升级数据库布局：
+//   - 全新的空数据库直接记录为最新版本；
+//   - 有数据但没有版本记录的数据库视为版本 0，执行全部迁移；
+//   - 版本高于程序支持的最新版本时拒绝打开，返回 ErrTooNew。
+func (r *Registry) Migrate(db kvstore.KVStore) error {
+	version, ok, err := ReadVersion(db)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		empty, err := isEmpty(db)
+		if err != nil {
+			return err
+		}
+		if empty {
+			return WriteVersion(db, r.Latest())
+		}
+	}
+	if version > r.Latest() {
+		return fmt.Errorf("%w: database version %d, supported %d", ErrTooNew, version, r.Latest())
+	}
+	for _, m := range r.migrations[version:] {
+		if err := m.Apply(db); err != nil {
+			return fmt.Errorf("schema: migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if err := WriteVersion(db, m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check 检查数据库布局是否是最新版本而不写入任何数据，用于只读打开。
+// 空数据库视为最新版本，需要迁移时返回 ErrOutdated
+func (r *Registry) Check(db kvstore.KVStore) error {
+	version, ok, err := ReadVersion(db)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		empty, err := isEmpty(db)
+		if err != nil || empty {
+			return err
+		}
+	}
+	if version > r.Latest() {
+		return fmt.Errorf("%w: database version %d, supported %d", ErrTooNew, version, r.Latest())
+	}
+	if version < r.Latest() {
+		return fmt.Errorf("%w: database version %d, supported %d", ErrOutdated, version, r.Latest())
+	}
+	return nil
+}
+
+// isEmpty 判断数据库中是否没有任何数据
+func isEmpty(db kvstore.KVStore) (bool, error) {
+	iter := db.NewIterator(nil)
+	defer iter.Release()
+
+	if iter.Next() {
+		return false, nil
+	}
+	return true, iter.Error()
+}
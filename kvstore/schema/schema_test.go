@@ -0,0 +1,63 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+)
+
+func TestMigrate(t *testing.T) {
+	var applied []uint64
+	record := func(v uint64) func(kvstore.KVStore) error {
+		return func(db kvstore.KVStore) error {
+			applied = append(applied, v)
+			return db.Put([]byte{byte(v)}, []byte("migrated"))
+		}
+	}
+	v1 := []Migration{{Version: 1, Name: "one", Apply: record(1)}}
+	v2 := append(v1, Migration{Version: 2, Name: "two", Apply: record(2)})
+
+	// 空数据库直接记录为最新版本，不执行迁移
+	db := memorydb.NewMemoryDB()
+	reg, _ := NewRegistry(v1...)
+	if err := reg.Migrate(db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("Fresh database should not run migrations, ran %v", applied)
+	}
+	if version, ok, _ := ReadVersion(db); !ok || version != 1 {
+		t.Errorf("Expected version 1, got %d (ok=%v)", version, ok)
+	}
+
+	// 升级到版本 2 只执行新的迁移
+	reg2, _ := NewRegistry(v2...)
+	if err := reg2.Migrate(db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != 1 || applied[0] != 2 {
+		t.Errorf("Expected only migration 2 to run, ran %v", applied)
+	}
+
+	// 旧程序拒绝打开新版本数据库
+	if err := reg.Migrate(db); !errors.Is(err, ErrTooNew) {
+		t.Errorf("Expected ErrTooNew, got %v", err)
+	}
+
+	// 没有版本记录但有数据的数据库从版本 0 开始迁移
+	applied = nil
+	legacy := memorydb.NewMemoryDB()
+	legacy.Put([]byte("legacy"), []byte("data"))
+	if err := reg2.Migrate(legacy); err != nil {
+		t.Fatalf("Migrate legacy failed: %v", err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("Expected both migrations on legacy database, ran %v", applied)
+	}
+
+	if _, err := NewRegistry(Migration{Version: 2}); !errors.Is(err, ErrBadMigrationID) {
+		t.Errorf("Expected ErrBadMigrationID, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package kvstore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrTxConflict = errors.New("kvstore: transaction conflict")
+	ErrTxDone     = errors.New("kvstore: transaction already committed or rolled back")
+)
+
+// TxTracker 记录每个键最近一次被修改时的序号，存储引擎借助它实现乐观事务。
+//
+// 事务开始时记下当前序号，提交时检查读过的键是否在这之后被修改过。
+// 引擎的所有写操作都要通过 Update 执行，有活跃事务时检查和写入在同一把锁内完成；
+// 这把锁只在写入时持有，事务执行期间不持锁。
+// 没有活跃事务时写操作不经过锁，也不记录任何键，因此记录表不会无限增长。
+type TxTracker struct {
+	lock      sync.Mutex
+	drained   *sync.Cond // 不经过锁的写操作全部完成时广播
+	seq       uint64
+	active    atomic.Int64 // 活跃事务数，只在持锁时修改
+	untracked atomic.Int64 // 正在执行的不经过锁的写操作数
+	written   map[string]uint64
+}
+
+// NewTxTracker 创建一个新的 TxTracker
+func NewTxTracker() *TxTracker {
+	t := &TxTracker{written: make(map[string]uint64)}
+	t.drained = sync.NewCond(&t.lock)
+	return t
+}
+
+// Update 执行写操作 write。没有活跃事务时直接写入，
+// 否则在提交锁内写入，成功后把 keys 标记为已修改
+func (t *TxTracker) Update(keys [][]byte, write func() error) error {
+	if t.active.Load() == 0 {
+		// 先登记再复查，和 Begin 的顺序相反，保证两者至少有一方看到对方
+		t.untracked.Add(1)
+		if t.active.Load() == 0 {
+			defer t.release()
+			return write()
+		}
+		t.release()
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := write(); err != nil {
+		return err
+	}
+	t.touch(keys)
+	return nil
+}
+
+// release 结束一个不经过锁的写操作，最后一个结束时唤醒等待的 Begin
+func (t *TxTracker) release() {
+	if t.untracked.Add(-1) == 0 && t.active.Load() > 0 {
+		t.lock.Lock()
+		t.drained.Broadcast()
+		t.lock.Unlock()
+	}
+}
+
+// touch 把 keys 标记为在新序号下被修改，调用方需持有锁
+func (t *TxTracker) touch(keys [][]byte) {
+	if t.active.Load() == 0 {
+		return
+	}
+	t.seq++
+	for _, key := range keys {
+		t.written[string(key)] = t.seq
+	}
+}
+
+// Begin 在 db 上开启一个事务。事务通过 db 读取数据，
+// 提交时用 write 写入批次，write 不能再经过 Update，否则会死锁
+func (t *TxTracker) Begin(db KVStore, write func(Batch) error) Transaction {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.active.Add(1)
+	// 等待已经开始的不经过锁的写操作完成，之后的写操作都会被记录。
+	// 等待期间释放锁，其他写操作可以继续经过锁写入
+	for t.untracked.Load() > 0 {
+		t.drained.Wait()
+	}
+	return &optimisticTx{
+		tracker: t,
+		db:      db,
+		write:   write,
+		start:   t.seq,
+		reads:   make(map[string]struct{}),
+		writes:  make(map[string]*txWrite),
+	}
+}
+
+// finish 结束一个事务，没有活跃事务时清空记录表，调用方需持有锁
+func (t *TxTracker) finish() {
+	if t.active.Add(-1) == 0 {
+		t.written = make(map[string]uint64)
+	}
+}
+
+// txWrite 是事务中对一个键的写入，value 为 nil 表示删除
+type txWrite struct {
+	key   []byte
+	value []byte
+}
+
+// optimisticTx 实现了Transaction接口
+type optimisticTx struct {
+	tracker *TxTracker
+	db      KVStore
+	write   func(Batch) error
+	start   uint64
+	reads   map[string]struct{}
+	writes  map[string]*txWrite
+	done    bool
+}
+
+func (tx *optimisticTx) Get(key []byte) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if w, ok := tx.writes[string(key)]; ok {
+		if w.value == nil {
+			return nil, ErrNotFound
+		}
+		return append([]byte{}, w.value...), nil
+	}
+	tx.reads[string(key)] = struct{}{}
+	return tx.db.Get(key)
+}
+
+func (tx *optimisticTx) Put(key []byte, value []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	tx.writes[string(key)] = &txWrite{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	}
+	return nil
+}
+
+func (tx *optimisticTx) Delete(key []byte) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.writes[string(key)] = &txWrite{key: append([]byte{}, key...)}
+	return nil
+}
+
+func (tx *optimisticTx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	t := tx.tracker
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tx.done = true
+	defer t.finish()
+
+	for key := range tx.reads {
+		if t.written[key] > tx.start {
+			return ErrTxConflict
+		}
+	}
+	if len(tx.writes) == 0 {
+		return nil
+	}
+	batch := tx.db.Batch()
+	keys := make([][]byte, 0, len(tx.writes))
+	for _, w := range tx.writes {
+		if w.value == nil {
+			batch.Delete(w.key)
+		} else {
+			batch.Put(w.key, w.value)
+		}
+		keys = append(keys, w.key)
+	}
+	if err := tx.write(batch); err != nil {
+		return err
+	}
+	t.touch(keys)
+	return nil
+}
+
+func (tx *optimisticTx) Rollback() {
+	if tx.done {
+		return
+	}
+	t := tx.tracker
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	tx.done = true
+	t.finish()
+}
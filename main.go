@@ -5,6 +5,7 @@ import (
 	"hyblockchain/crypto/secp256k1"
 	"hyblockchain/kvstore/leveldb"
 	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
 	"hyblockchain/statdb"
 	"hyblockchain/txpool"
 	"hyblockchain/types"
@@ -96,10 +97,10 @@ func testMPT() {
 	dbPath := "./mpt_testdb"
 	defer os.RemoveAll(dbPath)
 
-	// 创建 LevelDB 作为 MPT 的底层存储
-	db, err := leveldb.NewLevelDB(dbPath)
+	// 打开链数据库作为 MPT 的底层存储，打开时检查并升级数据布局版本
+	db, err := rawdb.Open(dbPath, nil)
 	if err != nil {
-		fmt.Printf("创建 LevelDB 失败: %v\n", err)
+		fmt.Printf("打开数据库失败: %v\n", err)
 		return
 	}
 	defer db.Close()
@@ -0,0 +1,62 @@
+package mpt
+
+import "errors"
+
+// ErrStopIteration 可以由 Iterate 的回调返回，用来提前结束遍历
+var ErrStopIteration = errors.New("mpt: stop iteration")
+
+// Iterate 按键的字典序遍历MPT中的所有键值对，需要的节点会从数据库加载。
+// 回调返回 ErrStopIteration 时结束遍历并返回 nil，返回其他错误时遍历中止并返回该错误
+func (m *MPT) Iterate(fn func(key, value []byte) error) error {
+	err := m.iterate(m.root, nil, fn)
+	if errors.Is(err, ErrStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// iterate 深度优先遍历，path 是到 n 为止的 nibble 路径
+func (m *MPT) iterate(n *Node, path []byte, fn func(key, value []byte) error) error {
+	if n == nil || n == m.emptyRoot {
+		return nil
+	}
+	n, err := m.resolve(n)
+	if err != nil {
+		return err
+	}
+
+	switch n.Type {
+	case LeafNode:
+		return emit(concat(path, n.Key), n.Value, fn)
+
+	case ExtensionNode:
+		return m.iterate(n.Children[0], concat(path, n.Key), fn)
+
+	case BranchNode:
+		if n.Value != nil {
+			if err := emit(path, n.Value, fn); err != nil {
+				return err
+			}
+		}
+		for i, child := range n.Children {
+			if err := m.iterate(child, concat(path, []byte{byte(i)}), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return errors.New("unknown node type")
+}
+
+// emit 把 nibble 路径还原成键后调用回调
+func emit(nibbles, value []byte, fn func(key, value []byte) error) error {
+	if len(nibbles)%2 != 0 {
+		return errBadNode
+	}
+	key := make([]byte, len(nibbles)/2)
+	for i := range key {
+		key[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return fn(key, value)
+}
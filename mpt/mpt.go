@@ -3,10 +3,24 @@ package mpt
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"hyblockchain/kvstore"
 )
 
+// hashLen 是节点哈希的长度
+const hashLen = sha256.Size
+
+var errBadNode = errors.New("mpt: malformed trie node")
+
+var (
+	// ErrNotFound 表示键不存在
+	ErrNotFound = errors.New("key not found")
+	// ErrMissingNode 表示数据库中缺少某个节点
+	ErrMissingNode = errors.New("mpt: missing trie node")
+)
+
 // MPT 表示一个Merkle Patricia Trie
 type MPT struct {
 	root      *Node
@@ -14,7 +28,7 @@ type MPT struct {
 	emptyRoot *Node // 唯一的空节点实例，保证空树哈希稳定
 }
 
-// NewMPT 创建新的MPT，初始化空节点并递归提交数据库
+// NewMPT 创建新的空MPT，不会写入数据库，可以在只读存储上使用
 func NewMPT(db kvstore.KVStore) *MPT {
 	emptyRoot := NewBranchNode()
 	mpt := &MPT{
@@ -22,20 +36,52 @@ func NewMPT(db kvstore.KVStore) *MPT {
 		emptyRoot: emptyRoot,
 		db:        db,
 	}
-	// 提交空节点到数据库，保证空节点hash和数据存在
-	mpt.commitNode(emptyRoot)
+	// 空节点只计算哈希而不写入数据库，以空树哈希为根打开时直接返回空树
+	emptyRoot.Hash = mpt.hashNode(emptyRoot)
+	emptyRoot.dirty = false
 	return mpt
 }
 
-// Put 在MPT中存储键值对
+// NewMPTWithRoot 打开数据库中以 root 为根的MPT，节点在访问时才从数据库加载。
+// root 为空或等于空树哈希时返回一棵空树
+func NewMPTWithRoot(db kvstore.KVStore, root []byte) (*MPT, error) {
+	mpt := NewMPT(db)
+	if len(root) == 0 || bytes.Equal(root, mpt.emptyRoot.Hash) {
+		return mpt, nil
+	}
+	has, err := db.Has(root)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, fmt.Errorf("%w: %x", ErrMissingNode, root)
+	}
+	mpt.root = newHashNode(root)
+	return mpt, nil
+}
+
+// EmptyRootHash 返回空树的根哈希
+func (m *MPT) EmptyRootHash() []byte {
+	return m.emptyRoot.Hash
+}
+
+// Put 在MPT中存储键值对并提交到数据库
 func (m *MPT) Put(key, value []byte) error {
+	if err := m.Update(key, value); err != nil {
+		return err
+	}
+	return m.commit()
+}
+
+// Update 在MPT中存储键值对，修改只保存在内存中，调用 Commit 后才写入数据库
+func (m *MPT) Update(key, value []byte) error {
 	nibbles := bytesToNibbles(key)
 	newRoot, err := m.insert(m.root, nibbles, value)
 	if err != nil {
 		return err
 	}
 	m.root = newRoot
-	return m.commit()
+	return nil
 }
 
 // Get 从MPT中获取值
@@ -44,8 +90,16 @@ func (m *MPT) Get(key []byte) ([]byte, error) {
 	return m.get(m.root, nibbles)
 }
 
-// Delete 从MPT中删除键值对
+// Delete 从MPT中删除键值对并提交到数据库
 func (m *MPT) Delete(key []byte) error {
+	if err := m.Remove(key); err != nil {
+		return err
+	}
+	return m.commit()
+}
+
+// Remove 从MPT中删除键值对，修改只保存在内存中，调用 Commit 后才写入数据库
+func (m *MPT) Remove(key []byte) error {
 	nibbles := bytesToNibbles(key)
 	newRoot, err := m.delete(m.root, nibbles)
 	if err != nil {
@@ -56,28 +110,68 @@ func (m *MPT) Delete(key []byte) error {
 		newRoot = m.emptyRoot
 	}
 	m.root = newRoot
-	return m.commit()
+	return nil
+}
+
+// Commit 把内存中的修改写入数据库，返回根哈希
+func (m *MPT) Commit() ([]byte, error) {
+	if err := m.commit(); err != nil {
+		return nil, err
+	}
+	return m.root.Hash, nil
+}
+
+// CommitTo 把内存中的修改写入 batch 而不写数据库，返回根哈希。
+// batch 由调用方和其他数据一起写入，写入失败后这棵树不能再使用
+func (m *MPT) CommitTo(batch kvstore.Batch) []byte {
+	m.commitNode(m.root, batch)
+	return m.root.Hash
 }
 
-// RootHash 获取MPT的根哈希
+// RootHash 获取MPT的根哈希，包含尚未提交的修改
 func (m *MPT) RootHash() []byte {
 	if m.root == nil {
 		return nil
 	}
+	m.hashDirty(m.root)
 	return m.root.Hash
 }
 
+// resolve 从数据库加载尚未加载的节点。加载结果直接写回原节点，
+// 这样父节点中的引用不需要更新
+func (m *MPT) resolve(n *Node) (*Node, error) {
+	if n == nil || n.Type != HashNode {
+		return n, nil
+	}
+	data, err := m.db.Get(n.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("%w %x: %v", ErrMissingNode, n.Hash, err)
+	}
+	decoded, err := deserializeNode(data)
+	if err != nil {
+		return nil, err
+	}
+	decoded.Hash = n.Hash
+	*n = *decoded
+	return n, nil
+}
+
 // insert 在MPT中插入或更新节点
 func (m *MPT) insert(n *Node, key []byte, value []byte) (*Node, error) {
 	if n == nil || n == m.emptyRoot {
 		return NewLeafNode(key, value), nil
 	}
+	n, err := m.resolve(n)
+	if err != nil {
+		return nil, err
+	}
 
 	switch n.Type {
 	case LeafNode:
 		common := commonPrefix(n.Key, key)
 		if common == len(n.Key) && common == len(key) {
 			n.Value = value
+			n.dirty = true
 			return n, nil
 		}
 		branch := NewBranchNode()
@@ -116,18 +210,16 @@ func (m *MPT) insert(n *Node, key []byte, value []byte) (*Node, error) {
 				return nil, err
 			}
 			n.Children[0] = child
+			n.dirty = true
 			return n, nil
 		}
 
+		// 路径在扩展节点中间分叉：原扩展节点剩余的路径挂到新分支节点下
 		branch := NewBranchNode()
-		if common < len(n.Key) {
-			child, err := m.insert(n.Children[0], n.Key[common+1:], n.Children[0].Value)
-			if err != nil {
-				return nil, err
-			}
-			branch.Children[n.Key[common]] = child
+		if rest := n.Key[common+1:]; len(rest) == 0 {
+			branch.Children[n.Key[common]] = n.Children[0]
 		} else {
-			branch.Value = n.Children[0].Value
+			branch.Children[n.Key[common]] = NewExtensionNode(rest, n.Children[0])
 		}
 
 		if common < len(key) {
@@ -144,6 +236,7 @@ func (m *MPT) insert(n *Node, key []byte, value []byte) (*Node, error) {
 	case BranchNode:
 		if len(key) == 0 {
 			n.Value = value
+			n.dirty = true
 			return n, nil
 		}
 		child, err := m.insert(n.Children[key[0]], key[1:], value)
@@ -151,6 +244,7 @@ func (m *MPT) insert(n *Node, key []byte, value []byte) (*Node, error) {
 			return nil, err
 		}
 		n.Children[key[0]] = child
+		n.dirty = true
 		return n, nil
 	}
 
@@ -160,7 +254,11 @@ func (m *MPT) insert(n *Node, key []byte, value []byte) (*Node, error) {
 // get 从MPT中获取值
 func (m *MPT) get(n *Node, key []byte) ([]byte, error) {
 	if n == nil || n == m.emptyRoot {
-		return nil, errors.New("key not found")
+		return nil, ErrNotFound
+	}
+	n, err := m.resolve(n)
+	if err != nil {
+		return nil, err
 	}
 
 	switch n.Type {
@@ -168,18 +266,18 @@ func (m *MPT) get(n *Node, key []byte) ([]byte, error) {
 		if bytes.Equal(n.Key, key) {
 			return n.Value, nil
 		}
-		return nil, errors.New("key not found")
+		return nil, ErrNotFound
 
 	case ExtensionNode:
 		if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
-			return nil, errors.New("key not found")
+			return nil, ErrNotFound
 		}
 		return m.get(n.Children[0], key[len(n.Key):])
 
 	case BranchNode:
 		if len(key) == 0 {
 			if n.Value == nil {
-				return nil, errors.New("key not found")
+				return nil, ErrNotFound
 			}
 			return n.Value, nil
 		}
@@ -189,11 +287,16 @@ func (m *MPT) get(n *Node, key []byte) ([]byte, error) {
 	return nil, errors.New("unknown node type")
 }
 
-// delete 从MPT中删除节点，空节点统一返回 m.emptyRoot
+// delete 从MPT中删除节点，空节点统一返回 m.emptyRoot。
+// 删除后会合并只剩一个子节点的分支节点，保证相同的数据总是得到相同的树结构
 func (m *MPT) delete(n *Node, key []byte) (*Node, error) {
 	if n == nil || n == m.emptyRoot {
 		return m.emptyRoot, nil
 	}
+	n, err := m.resolve(n)
+	if err != nil {
+		return nil, err
+	}
 
 	switch n.Type {
 	case LeafNode:
@@ -213,41 +316,68 @@ func (m *MPT) delete(n *Node, key []byte) (*Node, error) {
 		if child == m.emptyRoot {
 			return m.emptyRoot, nil
 		}
-		if child.Type == ExtensionNode {
-			return NewExtensionNode(append(n.Key, child.Key...), child.Children[0]), nil
+		switch child.Type {
+		case ExtensionNode:
+			return NewExtensionNode(concat(n.Key, child.Key), child.Children[0]), nil
+		case LeafNode:
+			return NewLeafNode(concat(n.Key, child.Key), child.Value), nil
+		}
+		n.Children[0] = child
+		if child.dirty {
+			n.dirty = true
 		}
-		return NewExtensionNode(n.Key, child), nil
+		return n, nil
 
 	case BranchNode:
 		if len(key) == 0 {
-			n.Value = nil
+			if n.Value != nil {
+				n.Value = nil
+				n.dirty = true
+			}
 		} else {
-			child, err := m.delete(n.Children[key[0]], key[1:])
+			old := n.Children[key[0]]
+			child, err := m.delete(old, key[1:])
 			if err != nil {
 				return nil, err
 			}
+			if child == m.emptyRoot {
+				child = nil
+			}
+			if child != old || (child != nil && child.dirty) {
+				n.dirty = true
+			}
 			n.Children[key[0]] = child
 		}
 
 		nonNilChildren := 0
 		lastChildIndex := -1
 		for i, child := range n.Children {
-			if child != nil && child != m.emptyRoot {
+			if child != nil {
 				nonNilChildren++
 				lastChildIndex = i
 			}
 		}
 
-		if nonNilChildren == 0 && n.Value == nil {
-			return m.emptyRoot, nil
+		if nonNilChildren == 0 {
+			if n.Value == nil {
+				return m.emptyRoot, nil
+			}
+			return NewLeafNode(nil, n.Value), nil
 		}
 
 		if nonNilChildren == 1 && n.Value == nil {
-			child := n.Children[lastChildIndex]
-			if child.Type == ExtensionNode {
-				return NewExtensionNode(append([]byte{byte(lastChildIndex)}, child.Key...), child.Children[0]), nil
+			child, err := m.resolve(n.Children[lastChildIndex])
+			if err != nil {
+				return nil, err
+			}
+			prefix := []byte{byte(lastChildIndex)}
+			switch child.Type {
+			case ExtensionNode:
+				return NewExtensionNode(concat(prefix, child.Key), child.Children[0]), nil
+			case LeafNode:
+				return NewLeafNode(concat(prefix, child.Key), child.Value), nil
 			}
-			return NewLeafNode(append([]byte{byte(lastChildIndex)}, child.Key...), child.Value), nil
+			return NewExtensionNode(prefix, child), nil
 		}
 		return n, nil
 	}
@@ -255,29 +385,41 @@ func (m *MPT) delete(n *Node, key []byte) (*Node, error) {
 	return nil, errors.New("unknown node type")
 }
 
-// commit 将MPT的更改提交到数据库，先递归提交子节点，保证哈希更新
+// commit 把修改过的节点写入同一个批次提交到数据库
 func (m *MPT) commit() error {
-	return m.commitNode(m.root)
+	batch := m.db.Batch()
+	m.CommitTo(batch)
+	return m.db.Write(batch)
 }
 
-// commitNode 递归提交节点到数据库
-func (m *MPT) commitNode(n *Node) error {
-	if n == nil {
-		return nil
+// commitNode 递归提交修改过的节点，先提交子节点，保证哈希更新
+func (m *MPT) commitNode(n *Node, batch kvstore.Batch) {
+	if n == nil || !n.dirty {
+		return
 	}
 
 	// 先提交所有子节点
 	for _, child := range n.Children {
-		if child != nil {
-			if err := m.commitNode(child); err != nil {
-				return err
-			}
-		}
+		m.commitNode(child, batch)
 	}
 
 	// 计算当前节点的哈希并存储
+	data := m.serializeNode(n)
+	hash := sha256.Sum256(data)
+	n.Hash = hash[:]
+	n.dirty = false
+	batch.Put(n.Hash, data)
+}
+
+// hashDirty 递归计算修改过的节点的哈希，节点仍保持未提交状态
+func (m *MPT) hashDirty(n *Node) {
+	if n == nil || !n.dirty {
+		return
+	}
+	for _, child := range n.Children {
+		m.hashDirty(child)
+	}
 	n.Hash = m.hashNode(n)
-	return m.db.Put(n.Hash, m.serializeNode(n))
 }
 
 // hashNode 计算节点的哈希
@@ -287,22 +429,28 @@ func (m *MPT) hashNode(n *Node) []byte {
 	return hash[:]
 }
 
-// serializeNode 序列化节点，保证顺序和格式稳定
+// serializeNode 序列化节点，保证顺序和格式稳定：
+//
+//	叶子节点：type | uvarint(len(key)) | key | value
+//	扩展节点：type | uvarint(len(key)) | key | child hash
+//	分支节点：type | 16 个子节点哈希（空为 32 字节 0）| 是否有值 | value
 func (m *MPT) serializeNode(n *Node) []byte {
 	var buf bytes.Buffer
 	buf.WriteByte(byte(n.Type))
 
 	switch n.Type {
 	case LeafNode:
+		buf.Write(binary.AppendUvarint(nil, uint64(len(n.Key))))
 		buf.Write(n.Key)
 		buf.Write(n.Value)
 
 	case ExtensionNode:
+		buf.Write(binary.AppendUvarint(nil, uint64(len(n.Key))))
 		buf.Write(n.Key)
 		if len(n.Children) > 0 && n.Children[0] != nil {
 			buf.Write(n.Children[0].Hash)
 		} else {
-			buf.Write(make([]byte, 32))
+			buf.Write(make([]byte, hashLen))
 		}
 
 	case BranchNode:
@@ -310,19 +458,73 @@ func (m *MPT) serializeNode(n *Node) []byte {
 			if child != nil {
 				buf.Write(child.Hash)
 			} else {
-				buf.Write(make([]byte, 32))
+				buf.Write(make([]byte, hashLen))
 			}
 		}
 		if n.Value != nil {
+			buf.WriteByte(1)
 			buf.Write(n.Value)
 		} else {
-			buf.Write([]byte{})
+			buf.WriteByte(0)
 		}
 	}
 
 	return buf.Bytes()
 }
 
+// deserializeNode 解析 serializeNode 生成的数据，子节点以 HashNode 的形式返回
+func deserializeNode(data []byte) (*Node, error) {
+	if len(data) == 0 {
+		return nil, errBadNode
+	}
+	n := &Node{Type: NodeType(data[0])}
+	data = data[1:]
+
+	switch n.Type {
+	case LeafNode, ExtensionNode:
+		size, read := binary.Uvarint(data)
+		if read <= 0 || uint64(len(data)-read) < size {
+			return nil, errBadNode
+		}
+		n.Key = append([]byte{}, data[read:read+int(size)]...)
+		data = data[read+int(size):]
+		if n.Type == LeafNode {
+			n.Value = append([]byte{}, data...)
+			return n, nil
+		}
+		if len(data) != hashLen {
+			return nil, errBadNode
+		}
+		n.Children[0] = newHashNode(append([]byte{}, data...))
+		return n, nil
+
+	case BranchNode:
+		if len(data) < 16*hashLen+1 {
+			return nil, errBadNode
+		}
+		empty := make([]byte, hashLen)
+		for i := range n.Children {
+			child := data[i*hashLen : (i+1)*hashLen]
+			if !bytes.Equal(child, empty) {
+				n.Children[i] = newHashNode(append([]byte{}, child...))
+			}
+		}
+		data = data[16*hashLen:]
+		if data[0] == 1 {
+			n.Value = append([]byte{}, data[1:]...)
+		}
+		return n, nil
+	}
+
+	return nil, errBadNode
+}
+
+// concat 拼接两段路径，返回新的切片，避免 append 修改共享的底层数组
+func concat(a, b []byte) []byte {
+	out := make([]byte, 0, len(a)+len(b))
+	return append(append(out, a...), b...)
+}
+
 // bytesToNibbles 将字节数组转换成nibbles
 func bytesToNibbles(b []byte) []byte {
 	nibbles := make([]byte, len(b)*2)
@@ -2,7 +2,10 @@ package mpt
 
 import (
 	"bytes"
+	"errors"
 	"hyblockchain/kvstore/leveldb"
+	"hyblockchain/kvstore/memorydb"
+	"strings"
 	"testing"
 )
 
@@ -143,3 +146,132 @@ func TestMPT(t *testing.T) {
 		t.Fatalf("Root hash after deleting all batch keys should equal empty tree root hash")
 	}
 }
+
+func TestMPTReopen(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+
+	keys := [][]byte{[]byte("do"), []byte("dog"), []byte("doge"), []byte("horse"), []byte("d"), []byte("cat")}
+
+	// 插入顺序不同，根哈希应相同
+	forward := NewMPT(db)
+	for _, k := range keys {
+		if err := forward.Put(k, append([]byte("v-"), k...)); err != nil {
+			t.Fatalf("Put %s failed: %v", k, err)
+		}
+	}
+	backward := NewMPT(db)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if err := backward.Put(keys[i], append([]byte("v-"), keys[i]...)); err != nil {
+			t.Fatalf("Put %s failed: %v", keys[i], err)
+		}
+	}
+	if !bytes.Equal(forward.RootHash(), backward.RootHash()) {
+		t.Fatalf("Root hash depends on insertion order: %x != %x", forward.RootHash(), backward.RootHash())
+	}
+
+	// 从根哈希重新打开
+	reopened, err := NewMPTWithRoot(db, forward.RootHash())
+	if err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+	for _, k := range keys {
+		got, err := reopened.Get(k)
+		if err != nil || !bytes.Equal(got, append([]byte("v-"), k...)) {
+			t.Fatalf("Get %s after reopen: got %s, %v", k, got, err)
+		}
+	}
+	if _, err := reopened.Get([]byte("dogs")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	// 在重新打开的树上删除，结果应与直接删除一致
+	if err := reopened.Delete([]byte("doge")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := forward.Delete([]byte("doge")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if !bytes.Equal(forward.RootHash(), reopened.RootHash()) {
+		t.Fatalf("Root hash mismatch after delete: %x != %x", forward.RootHash(), reopened.RootHash())
+	}
+
+	if _, err := NewMPTWithRoot(db, bytes.Repeat([]byte{0xff}, 32)); !errors.Is(err, ErrMissingNode) {
+		t.Fatalf("Expected ErrMissingNode, got %v", err)
+	}
+}
+
+func TestMPTIterate(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	mpt := NewMPT(db)
+
+	keys := []string{"horse", "do", "doge", "cat", "dog", "d"}
+	for _, k := range keys {
+		if err := mpt.Put([]byte(k), []byte("v-"+k)); err != nil {
+			t.Fatalf("Put %s failed: %v", k, err)
+		}
+	}
+	reopened, err := NewMPTWithRoot(db, mpt.RootHash())
+	if err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+
+	var got []string
+	err = reopened.Iterate(func(key, value []byte) error {
+		if string(value) != "v-"+string(key) {
+			t.Errorf("Unexpected value %s for key %s", value, key)
+		}
+		got = append(got, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Iterate failed: %v", err)
+	}
+	want := []string{"cat", "d", "do", "dog", "doge", "horse"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("Iterate order: want %v, got %v", want, got)
+	}
+
+	count := 0
+	err = reopened.Iterate(func(key, value []byte) error {
+		count++
+		return ErrStopIteration
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("Expected iteration to stop after 1 entry, got %d, %v", count, err)
+	}
+}
+
+func TestMPTOpenReadOnly(t *testing.T) {
+	db := memorydb.NewMemoryDB().(*memorydb.MemoryDB)
+
+	// 打开空树和以空树哈希为根的树都不写入数据库
+	empty := NewMPT(db)
+	reopened, err := NewMPTWithRoot(db, empty.RootHash())
+	if err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+	if db.Len() != 0 {
+		t.Fatalf("Expected opening an empty trie to write nothing, got %d entries", db.Len())
+	}
+	if _, err := reopened.Get([]byte("key")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// 删空后提交的树仍然可以按空树哈希重新打开
+	if err := empty.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := empty.Delete([]byte("key")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	root, err := empty.Commit()
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if !bytes.Equal(root, empty.EmptyRootHash()) {
+		t.Fatalf("Expected empty root after deleting everything, got %x", root)
+	}
+	if _, err := NewMPTWithRoot(db, root); err != nil {
+		t.Fatalf("NewMPTWithRoot failed: %v", err)
+	}
+}
@@ -7,6 +7,7 @@ const (
 	BranchNode    NodeType = 0
 	ExtensionNode NodeType = 1
 	LeafNode      NodeType = 2
+	HashNode      NodeType = 3 // 尚未从数据库加载的节点，只有 Hash 有效
 )
 
 // Node 表示MPT中的一个节点
@@ -16,6 +17,8 @@ type Node struct {
 	Value    []byte    // 存储值（仅叶子节点用）
 	Children [16]*Node // 子节点数组（仅分支节点使用）
 	Hash     []byte    // 当前节点的哈希（默认为 nil，需外部生成）
+
+	dirty bool // 节点在上次提交后被修改过，Hash 需要重新计算
 }
 
 // NewBranchNode 创建一个新的分支节点
@@ -23,6 +26,7 @@ func NewBranchNode() *Node {
 	return &Node{
 		Type:     BranchNode,
 		Children: [16]*Node{},
+		dirty:    true,
 	}
 }
 
@@ -32,6 +36,7 @@ func NewExtensionNode(key []byte, child *Node) *Node {
 		Type:     ExtensionNode,
 		Key:      key,
 		Children: [16]*Node{0: child},
+		dirty:    true,
 	}
 }
 
@@ -41,5 +46,14 @@ func NewLeafNode(key []byte, value []byte) *Node {
 		Type:  LeafNode,
 		Key:   key,
 		Value: value,
+		dirty: true,
+	}
+}
+
+// newHashNode 创建一个只记录哈希、按需从数据库加载的节点
+func newHashNode(hash []byte) *Node {
+	return &Node{
+		Type: HashNode,
+		Hash: hash,
 	}
 }
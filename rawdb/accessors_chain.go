@@ -0,0 +1,192 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+var errBadNumber = errors.New("rawdb: malformed block number")
+
+// ReadCanonicalHash 读取规范链上高度为 number 的区块哈希
+func ReadCanonicalHash(db kvstore.KVStore, number uint64) (hash.Hash, error) {
+	data, err := db.Get(headerHashKey(number))
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.BytesToHash(data), nil
+}
+
+// WriteCanonicalHash 把 hash 记录为规范链上高度为 number 的区块
+func WriteCanonicalHash(db kvstore.KVStore, hash hash.Hash, number uint64) error {
+	return db.Put(headerHashKey(number), hash.Bytes())
+}
+
+// DeleteCanonicalHash 删除规范链上高度为 number 的记录
+func DeleteCanonicalHash(db kvstore.KVStore, number uint64) error {
+	return db.Delete(headerHashKey(number))
+}
+
+// ReadHeaderNumber 读取区块哈希对应的高度
+func ReadHeaderNumber(db kvstore.KVStore, hash hash.Hash) (uint64, error) {
+	data, err := db.Get(headerNumberKey(hash))
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, errBadNumber
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// ReadHeadHeaderHash 读取最新区块头的哈希
+func ReadHeadHeaderHash(db kvstore.KVStore) (hash.Hash, error) {
+	data, err := db.Get(headHeaderKey)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.BytesToHash(data), nil
+}
+
+// WriteHeadHeaderHash 记录最新区块头的哈希
+func WriteHeadHeaderHash(db kvstore.KVStore, hash hash.Hash) error {
+	return db.Put(headHeaderKey, hash.Bytes())
+}
+
+// ReadHeadBlockHash 读取最新完整区块的哈希
+func ReadHeadBlockHash(db kvstore.KVStore) (hash.Hash, error) {
+	data, err := db.Get(headBlockKey)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.BytesToHash(data), nil
+}
+
+// WriteHeadBlockHash 记录最新完整区块的哈希
+func WriteHeadBlockHash(db kvstore.KVStore, hash hash.Hash) error {
+	return db.Put(headBlockKey, hash.Bytes())
+}
+
+// ReadHeader 读取区块头
+func ReadHeader(db kvstore.KVStore, hash hash.Hash, number uint64) (*types.Header, error) {
+	data, err := db.Get(headerKey(number, hash))
+	if err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// WriteHeader 写入区块头以及哈希到高度的映射
+func WriteHeader(db kvstore.KVStore, header *types.Header) error {
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return err
+	}
+	hash := header.Hash()
+	batch := db.Batch()
+	batch.Put(headerNumberKey(hash), encodeBlockNumber(header.Height))
+	batch.Put(headerKey(header.Height, hash), data)
+	return db.Write(batch)
+}
+
+// DeleteHeader 删除区块头以及哈希到高度的映射
+func DeleteHeader(db kvstore.KVStore, hash hash.Hash, number uint64) error {
+	batch := db.Batch()
+	batch.Delete(headerKey(number, hash))
+	batch.Delete(headerNumberKey(hash))
+	return db.Write(batch)
+}
+
+// ReadBody 读取区块体
+func ReadBody(db kvstore.KVStore, hash hash.Hash, number uint64) (*types.Body, error) {
+	data, err := db.Get(blockBodyKey(number, hash))
+	if err != nil {
+		return nil, err
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(data, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// WriteBody 写入区块体
+func WriteBody(db kvstore.KVStore, hash hash.Hash, number uint64, body *types.Body) error {
+	data, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		return err
+	}
+	return db.Put(blockBodyKey(number, hash), data)
+}
+
+// DeleteBody 删除区块体
+func DeleteBody(db kvstore.KVStore, hash hash.Hash, number uint64) error {
+	return db.Delete(blockBodyKey(number, hash))
+}
+
+// ReadBlock 读取完整区块
+func ReadBlock(db kvstore.KVStore, hash hash.Hash, number uint64) (*types.Block, error) {
+	header, err := ReadHeader(db, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ReadBody(db, hash, number)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Block{Header: header, Body: body}, nil
+}
+
+// WriteBlock 写入区块头和区块体
+func WriteBlock(db kvstore.KVStore, block *types.Block) error {
+	if err := WriteBody(db, block.Hash(), block.Height(), block.Body); err != nil {
+		return err
+	}
+	return WriteHeader(db, block.Header)
+}
+
+// DeleteBlock 删除区块头、区块体和收据
+func DeleteBlock(db kvstore.KVStore, hash hash.Hash, number uint64) error {
+	if err := DeleteReceipts(db, hash, number); err != nil {
+		return err
+	}
+	if err := DeleteBody(db, hash, number); err != nil {
+		return err
+	}
+	return DeleteHeader(db, hash, number)
+}
+
+// ReadReceipts 读取区块中所有交易的收据
+func ReadReceipts(db kvstore.KVStore, hash hash.Hash, number uint64) ([]*types.Receipt, error) {
+	data, err := db.Get(blockReceiptsKey(number, hash))
+	if err != nil {
+		return nil, err
+	}
+	var receipts []*types.Receipt
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// WriteReceipts 写入区块中所有交易的收据
+func WriteReceipts(db kvstore.KVStore, hash hash.Hash, number uint64, receipts []*types.Receipt) error {
+	data, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		return err
+	}
+	return db.Put(blockReceiptsKey(number, hash), data)
+}
+
+// DeleteReceipts 删除区块的收据
+func DeleteReceipts(db kvstore.KVStore, hash hash.Hash, number uint64) error {
+	return db.Delete(blockReceiptsKey(number, hash))
+}
@@ -0,0 +1,82 @@
+package rawdb
+
+import (
+	"hyblockchain/kvstore"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+// TxLookupEntry 记录交易所在的区块及其在区块中的位置
+type TxLookupEntry struct {
+	BlockHash   hash.Hash
+	BlockNumber uint64
+	Index       uint64
+}
+
+// ReadTxLookupEntry 读取交易的位置索引
+func ReadTxLookupEntry(db kvstore.KVStore, txHash hash.Hash) (*TxLookupEntry, error) {
+	data, err := db.Get(txLookupKey(txHash))
+	if err != nil {
+		return nil, err
+	}
+	entry := new(TxLookupEntry)
+	if err := rlp.DecodeBytes(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// WriteTxLookupEntries 为区块中的每笔交易写入位置索引
+func WriteTxLookupEntries(db kvstore.KVStore, block *types.Block) error {
+	batch := db.Batch()
+	for i, tx := range block.Body.Transactions {
+		data, err := rlp.EncodeToBytes(&TxLookupEntry{
+			BlockHash:   block.Hash(),
+			BlockNumber: block.Height(),
+			Index:       uint64(i),
+		})
+		if err != nil {
+			return err
+		}
+		batch.Put(txLookupKey(tx.Hash()), data)
+	}
+	return db.Write(batch)
+}
+
+// DeleteTxLookupEntry 删除交易的位置索引
+func DeleteTxLookupEntry(db kvstore.KVStore, txHash hash.Hash) error {
+	return db.Delete(txLookupKey(txHash))
+}
+
+// ReadTransaction 通过位置索引读取交易，同时返回它所在的区块位置
+func ReadTransaction(db kvstore.KVStore, txHash hash.Hash) (*types.Transaction, *TxLookupEntry, error) {
+	entry, err := ReadTxLookupEntry(db, txHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ReadBody(db, entry.BlockHash, entry.BlockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry.Index >= uint64(len(body.Transactions)) {
+		return nil, nil, kvstore.ErrNotFound
+	}
+	return body.Transactions[entry.Index], entry, nil
+}
+
+// ReadReceipt 通过位置索引读取交易收据
+func ReadReceipt(db kvstore.KVStore, txHash hash.Hash) (*types.Receipt, *TxLookupEntry, error) {
+	entry, err := ReadTxLookupEntry(db, txHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	receipts, err := ReadReceipts(db, entry.BlockHash, entry.BlockNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	if entry.Index >= uint64(len(receipts)) {
+		return nil, nil, kvstore.ErrNotFound
+	}
+	return receipts[entry.Index], entry, nil
+}
@@ -0,0 +1,88 @@
+package rawdb
+
+import (
+	"bytes"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// 快照的写入总是和快照根一起通过批次提交，所以写函数接收 kvstore.Batch
+
+// ReadSnapshotRoot 读取磁盘快照对应的状态根
+func ReadSnapshotRoot(db kvstore.KVStore) (hash.Hash, error) {
+	data, err := db.Get(snapshotRootKey)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.BytesToHash(data), nil
+}
+
+// WriteSnapshotRoot 记录磁盘快照对应的状态根
+func WriteSnapshotRoot(batch kvstore.Batch, root hash.Hash) {
+	batch.Put(snapshotRootKey, root.Bytes())
+}
+
+// DeleteSnapshotRoot 删除磁盘快照的状态根，表示快照不可用
+func DeleteSnapshotRoot(db kvstore.KVStore) error {
+	return db.Delete(snapshotRootKey)
+}
+
+// ReadAccountSnapshot 读取快照中账户的 RLP 编码
+func ReadAccountSnapshot(db kvstore.KVStore, addr types.Address) ([]byte, error) {
+	return db.Get(snapshotAccountKey(addr))
+}
+
+// WriteAccountSnapshot 写入快照中账户的 RLP 编码
+func WriteAccountSnapshot(batch kvstore.Batch, addr types.Address, data []byte) {
+	batch.Put(snapshotAccountKey(addr), data)
+}
+
+// DeleteAccountSnapshot 删除快照中的账户
+func DeleteAccountSnapshot(batch kvstore.Batch, addr types.Address) {
+	batch.Delete(snapshotAccountKey(addr))
+}
+
+// ReadStorageSnapshot 读取快照中的存储值
+func ReadStorageSnapshot(db kvstore.KVStore, addr types.Address, key hash.Hash) ([]byte, error) {
+	return db.Get(snapshotStorageKey(addr, key))
+}
+
+// WriteStorageSnapshot 写入快照中的存储值
+func WriteStorageSnapshot(batch kvstore.Batch, addr types.Address, key hash.Hash, value []byte) {
+	batch.Put(snapshotStorageKey(addr, key), value)
+}
+
+// DeleteStorageSnapshot 删除快照中的存储值
+func DeleteStorageSnapshot(batch kvstore.Batch, addr types.Address, key hash.Hash) {
+	batch.Delete(snapshotStorageKey(addr, key))
+}
+
+// DeleteAccountStorageSnapshot 删除快照中账户的全部存储值
+func DeleteAccountStorageSnapshot(db kvstore.KVStore, batch kvstore.Batch, addr types.Address) error {
+	prefix := append(append([]byte{}, snapshotStoragePrefix...), addr[:]...)
+	return deleteByPrefix(db, batch, prefix, snapshotStorageKeyLength)
+}
+
+// DeleteSnapshot 删除整个磁盘快照
+func DeleteSnapshot(db kvstore.KVStore, batch kvstore.Batch) error {
+	batch.Delete(snapshotRootKey)
+	if err := deleteByPrefix(db, batch, snapshotAccountPrefix, snapshotAccountKeyLength); err != nil {
+		return err
+	}
+	return deleteByPrefix(db, batch, snapshotStoragePrefix, snapshotStorageKeyLength)
+}
+
+// deleteByPrefix 删除前缀为 prefix 且长度为 length 的所有键
+func deleteByPrefix(db kvstore.KVStore, batch kvstore.Batch, prefix []byte, length int) error {
+	iter := db.NewIterator(prefix)
+	defer iter.Release()
+
+	for iter.Next() {
+		if key := iter.Key(); len(key) == length && bytes.HasPrefix(key, prefix) {
+			batch.Delete(append([]byte{}, key...))
+		}
+	}
+	return iter.Error()
+}
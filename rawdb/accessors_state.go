@@ -0,0 +1,69 @@
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// ReadCode 读取哈希为 hash 的合约代码
+func ReadCode(db kvstore.KVStore, hash hash.Hash) ([]byte, error) {
+	return db.Get(codeKey(hash))
+}
+
+// HasCode 判断哈希为 hash 的合约代码是否已经存在
+func HasCode(db kvstore.KVStore, hash hash.Hash) (bool, error) {
+	return db.Has(codeKey(hash))
+}
+
+// WriteCode 以代码哈希为键写入合约代码，相同的代码只会保存一份
+func WriteCode(batch kvstore.Batch, hash hash.Hash, code []byte) {
+	batch.Put(codeKey(hash), code)
+}
+
+// ReadStateRoot 读取高度为 number 时提交的状态根
+func ReadStateRoot(db kvstore.KVStore, number uint64) (hash.Hash, error) {
+	data, err := db.Get(stateRootKey(number))
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.BytesToHash(data), nil
+}
+
+// WriteStateRoot 记录高度为 number 时提交的状态根
+func WriteStateRoot(batch kvstore.Batch, number uint64, root hash.Hash) {
+	batch.Put(stateRootKey(number), root.Bytes())
+}
+
+// WriteAccountHistory 记录账户在高度 number 时的新编码，data 为空表示账户被删除
+func WriteAccountHistory(batch kvstore.Batch, addr types.Address, number uint64, data []byte) {
+	batch.Put(accountHistoryKey(addr, number), data)
+}
+
+// IterateAccountHistory 按高度顺序遍历账户在 [from, to] 之间的修改记录
+func IterateAccountHistory(db kvstore.KVStore, addr types.Address, from, to uint64, fn func(number uint64, data []byte) error) error {
+	prefix := append(append([]byte{}, accountHistoryPrefix...), addr[:]...)
+	iter := db.NewIterator(prefix)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != accountHistoryKeyLength || !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+		number := binary.BigEndian.Uint64(key[len(prefix):])
+		if number < from {
+			continue
+		}
+		if number > to {
+			break
+		}
+		if err := fn(number, iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
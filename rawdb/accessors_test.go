@@ -0,0 +1,93 @@
+package rawdb
+
+import (
+	"errors"
+	"testing"
+
+	"hyblockchain/crypto/secp256k1"
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/types"
+)
+
+func TestChainAccessors(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	defer db.Close()
+
+	priv, _ := secp256k1.GenerateKey()
+	to := types.PubKeyToAddress(secp256k1.PubKeyFromPrivKey(priv))
+	tx1, _ := types.NewTransactionWithSigner(to, 1, 21000, 100, 10, priv)
+	tx2, _ := types.NewTransactionWithSigner(to, 2, 21000, 200, 10, priv)
+
+	block := &types.Block{
+		Header: &types.Header{Height: 1, Timestamp: 1700000000},
+		Body:   &types.Body{Transactions: []*types.Transaction{tx1, tx2}},
+	}
+	hash := block.Hash()
+
+	if err := WriteBlock(db, block); err != nil {
+		t.Fatalf("WriteBlock failed: %v", err)
+	}
+	if err := WriteCanonicalHash(db, hash, 1); err != nil {
+		t.Fatalf("WriteCanonicalHash failed: %v", err)
+	}
+	if err := WriteHeadBlockHash(db, hash); err != nil {
+		t.Fatalf("WriteHeadBlockHash failed: %v", err)
+	}
+	if err := WriteTxLookupEntries(db, block); err != nil {
+		t.Fatalf("WriteTxLookupEntries failed: %v", err)
+	}
+	receipts := []*types.Receipt{
+		{TxHash: tx1.Hash(), Status: types.ReceiptStatusSuccessful, GasUsed: 21000},
+		{TxHash: tx2.Hash(), Status: types.ReceiptStatusFailed, GasUsed: 21000},
+	}
+	if err := WriteReceipts(db, hash, 1, receipts); err != nil {
+		t.Fatalf("WriteReceipts failed: %v", err)
+	}
+
+	if got, _ := ReadCanonicalHash(db, 1); got != hash {
+		t.Errorf("Canonical hash mismatch: want %x, got %x", hash, got)
+	}
+	if got, _ := ReadHeadBlockHash(db); got != hash {
+		t.Errorf("Head block hash mismatch")
+	}
+	if number, _ := ReadHeaderNumber(db, hash); number != 1 {
+		t.Errorf("Expected header number 1, got %d", number)
+	}
+
+	got, err := ReadBlock(db, hash, 1)
+	if err != nil {
+		t.Fatalf("ReadBlock failed: %v", err)
+	}
+	if got.Hash() != hash {
+		t.Errorf("Block hash mismatch after round trip")
+	}
+	if len(got.Body.Transactions) != 2 || got.Body.Transactions[1].Hash() != tx2.Hash() {
+		t.Errorf("Body transactions mismatch after round trip")
+	}
+
+	tx, entry, err := ReadTransaction(db, tx2.Hash())
+	if err != nil {
+		t.Fatalf("ReadTransaction failed: %v", err)
+	}
+	if tx.Nonce() != 2 || entry.Index != 1 || entry.BlockHash != hash {
+		t.Errorf("Unexpected lookup result: nonce=%d index=%d", tx.Nonce(), entry.Index)
+	}
+	receipt, _, err := ReadReceipt(db, tx1.Hash())
+	if err != nil {
+		t.Fatalf("ReadReceipt failed: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.TxHash != tx1.Hash() {
+		t.Errorf("Unexpected receipt: %+v", receipt)
+	}
+
+	if err := DeleteBlock(db, hash, 1); err != nil {
+		t.Fatalf("DeleteBlock failed: %v", err)
+	}
+	if _, err := ReadHeader(db, hash, 1); !errors.Is(err, kvstore.ErrNotFound) {
+		t.Errorf("Expected header to be deleted, got %v", err)
+	}
+	if _, err := ReadReceipts(db, hash, 1); !errors.Is(err, kvstore.ErrNotFound) {
+		t.Errorf("Expected receipts to be deleted, got %v", err)
+	}
+}
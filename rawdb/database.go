@@ -0,0 +1,26 @@
+package rawdb
+
+import (
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/leveldb"
+	"hyblockchain/kvstore/schema"
+)
+
+// Open 打开节点的链数据库并检查数据布局版本，options 为 nil 时使用默认参数。
+// 读写打开时执行尚未完成的迁移，只读打开时只检查版本，需要迁移时返回错误
+func Open(path string, options *leveldb.Options) (kvstore.KVStore, error) {
+	db, err := leveldb.NewLevelDBWithOptions(path, options)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil && options.ReadOnly {
+		err = schema.Check(db)
+	} else {
+		err = schema.Migrate(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
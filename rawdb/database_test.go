@@ -0,0 +1,46 @@
+package rawdb
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"hyblockchain/kvstore/leveldb"
+	"hyblockchain/kvstore/schema"
+)
+
+func TestOpen(t *testing.T) {
+	dbPath := "testdb_open"
+	defer os.RemoveAll(dbPath)
+
+	// 新建的数据库记录为最新版本
+	db, err := Open(dbPath, nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if version, ok, _ := schema.ReadVersion(db); !ok || version != schema.Default.Latest() {
+		t.Errorf("Expected version %d, got %d (ok=%v)", schema.Default.Latest(), version, ok)
+	}
+	db.Close()
+
+	ro, err := Open(dbPath, &leveldb.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Open read-only failed: %v", err)
+	}
+	ro.Close()
+
+	// 旧版本的数据库读写打开时执行迁移，只读打开时拒绝
+	db, err = leveldb.NewLevelDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+	schema.WriteVersion(db, 1)
+	db.Close()
+
+	if _, err := Open(dbPath, &leveldb.Options{ReadOnly: true}); !errors.Is(err, schema.ErrOutdated) {
+		t.Errorf("Expected ErrOutdated, got %v", err)
+	}
+	if _, err := Open(dbPath, nil); !errors.Is(err, schema.ErrIncompatible) {
+		t.Errorf("Expected ErrIncompatible, got %v", err)
+	}
+}
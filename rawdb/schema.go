@@ -0,0 +1,102 @@
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// 链数据在 KVStore 中的键布局，所有子系统都应通过本包读写链数据
+var (
+	headHeaderKey = []byte("LastHeader") // 最新区块头的哈希
+	headBlockKey  = []byte("LastBlock")  // 最新完整区块的哈希
+
+	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
+	headerHashSuffix   = []byte("n") // headerPrefix + num (uint64 big endian) + headerHashSuffix -> 规范链上的区块哈希
+	headerNumberPrefix = []byte("H") // headerNumberPrefix + hash -> num (uint64 big endian)
+
+	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
+	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
+
+	txLookupPrefix = []byte("l") // txLookupPrefix + hash -> 交易所在的区块
+
+	codePrefix = []byte("c") // codePrefix + code hash -> 合约代码
+
+	snapshotRootKey       = []byte("SnapshotRoot") // 磁盘快照对应的状态根
+	snapshotAccountPrefix = []byte("a")            // snapshotAccountPrefix + address -> 账户 RLP
+	snapshotStoragePrefix = []byte("o")            // snapshotStoragePrefix + address + key -> 存储值
+
+	stateRootPrefix      = []byte("s") // stateRootPrefix + num (uint64 big endian) -> 该高度提交的状态根
+	accountHistoryPrefix = []byte("y") // accountHistoryPrefix + address + num (uint64 big endian) -> 账户 RLP，空值表示删除
+)
+
+// 快照键的长度。MPT 节点以 32 字节哈希为键和快照存放在同一个库中，
+// 按前缀遍历快照时需要用长度把节点排除掉
+const (
+	snapshotAccountKeyLength = 1 + 20
+	snapshotStorageKeyLength = 1 + 20 + hash.HASH_LEN
+	accountHistoryKeyLength  = 1 + 20 + 8
+)
+
+// encodeBlockNumber 把区块高度编码成 8 字节大端序
+func encodeBlockNumber(number uint64) []byte {
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, number)
+	return enc
+}
+
+// headerKey = headerPrefix + num (uint64 big endian) + hash
+func headerKey(number uint64, hash hash.Hash) []byte {
+	return append(append(append([]byte{}, headerPrefix...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// headerHashKey = headerPrefix + num (uint64 big endian) + headerHashSuffix
+func headerHashKey(number uint64) []byte {
+	return append(append(append([]byte{}, headerPrefix...), encodeBlockNumber(number)...), headerHashSuffix...)
+}
+
+// headerNumberKey = headerNumberPrefix + hash
+func headerNumberKey(hash hash.Hash) []byte {
+	return append(append([]byte{}, headerNumberPrefix...), hash.Bytes()...)
+}
+
+// blockBodyKey = blockBodyPrefix + num (uint64 big endian) + hash
+func blockBodyKey(number uint64, hash hash.Hash) []byte {
+	return append(append(append([]byte{}, blockBodyPrefix...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// blockReceiptsKey = blockReceiptsPrefix + num (uint64 big endian) + hash
+func blockReceiptsKey(number uint64, hash hash.Hash) []byte {
+	return append(append(append([]byte{}, blockReceiptsPrefix...), encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// txLookupKey = txLookupPrefix + hash
+func txLookupKey(hash hash.Hash) []byte {
+	return append(append([]byte{}, txLookupPrefix...), hash.Bytes()...)
+}
+
+// codeKey = codePrefix + hash
+func codeKey(hash hash.Hash) []byte {
+	return append(append([]byte{}, codePrefix...), hash.Bytes()...)
+}
+
+// snapshotAccountKey = snapshotAccountPrefix + address
+func snapshotAccountKey(addr types.Address) []byte {
+	return append(append([]byte{}, snapshotAccountPrefix...), addr[:]...)
+}
+
+// snapshotStorageKey = snapshotStoragePrefix + address + key
+func snapshotStorageKey(addr types.Address, key hash.Hash) []byte {
+	return append(append(append([]byte{}, snapshotStoragePrefix...), addr[:]...), key.Bytes()...)
+}
+
+// stateRootKey = stateRootPrefix + num (uint64 big endian)
+func stateRootKey(number uint64) []byte {
+	return append(append([]byte{}, stateRootPrefix...), encodeBlockNumber(number)...)
+}
+
+// accountHistoryKey = accountHistoryPrefix + address + num (uint64 big endian)
+func accountHistoryKey(addr types.Address, number uint64) []byte {
+	return append(append(append([]byte{}, accountHistoryPrefix...), addr[:]...), encodeBlockNumber(number)...)
+}
@@ -1,12 +1,16 @@
 package statdb
 
 import (
-	"hash"
+	"fmt"
 	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/math"
+	"sync"
 )
 
-// MockStatDB 是一个内存实现的 StatDB 模拟对象
+// MockStatDB 是一个内存实现的 StatDB 模拟对象，可以被多个协程同时使用
 type MockStatDB struct {
+	lock     sync.Mutex
 	accounts map[types.Address]types.Account
 	root     hash.Hash
 }
@@ -19,6 +23,13 @@ func NewMockStatDB() *MockStatDB {
 
 // Load 返回指定地址的账户信息，找不到时返回空账户(Nonce=0)
 func (db *MockStatDB) Load(addr types.Address) *types.Account {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.load(addr)
+}
+
+func (db *MockStatDB) load(addr types.Address) *types.Account {
 	acc, ok := db.accounts[addr]
 	if !ok {
 		return &types.Account{}
@@ -28,6 +39,13 @@ func (db *MockStatDB) Load(addr types.Address) *types.Account {
 
 // Store 设置指定地址的账户信息
 func (db *MockStatDB) Store(addr types.Address, account *types.Account) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.store(addr, account)
+}
+
+func (db *MockStatDB) store(addr types.Address, account *types.Account) {
 	if account == nil {
 		delete(db.accounts, addr)
 		return
@@ -35,8 +53,21 @@ func (db *MockStatDB) Store(addr types.Address, account *types.Account) {
 	db.accounts[addr] = *account
 }
 
+// DeleteAccount 删除账户，返回账户原来是否存在
+func (db *MockStatDB) DeleteAccount(addr types.Address) bool {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	_, ok := db.accounts[addr]
+	delete(db.accounts, addr)
+	return ok
+}
+
 // SetRoot 设置状态树根哈希（模拟用）
 func (db *MockStatDB) SetRoot(root hash.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
 	db.root = root
 }
 
@@ -44,3 +75,87 @@ func (db *MockStatDB) SetRoot(root hash.Hash) {
 func (db *MockStatDB) SetStatRoot(root hash.Hash) {
 	db.SetRoot(root)
 }
+
+// AddBalance 增加账户余额，溢出时返回 ErrBalanceOverflow
+func (db *MockStatDB) AddBalance(addr types.Address, amount uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.addBalance(addr, amount)
+}
+
+func (db *MockStatDB) addBalance(addr types.Address, amount uint64) error {
+	acc := db.load(addr)
+	balance, overflow := math.SafeAdd(acc.Amount, amount)
+	if overflow {
+		return fmt.Errorf("%w: address %x", ErrBalanceOverflow, addr)
+	}
+	acc.Amount = balance
+	db.store(addr, acc)
+	return nil
+}
+
+// SubBalance 扣减账户余额，余额不足时返回 ErrInsufficientBalance
+func (db *MockStatDB) SubBalance(addr types.Address, amount uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.subBalance(addr, amount)
+}
+
+func (db *MockStatDB) subBalance(addr types.Address, amount uint64) error {
+	acc := db.load(addr)
+	balance, underflow := math.SafeSub(acc.Amount, amount)
+	if underflow {
+		return fmt.Errorf("%w: address %x has %d, need %d", ErrInsufficientBalance, addr, acc.Amount, amount)
+	}
+	acc.Amount = balance
+	db.store(addr, acc)
+	return nil
+}
+
+// Transfer 从 from 向 to 转账，失败时两个账户都不会被修改
+func (db *MockStatDB) Transfer(from, to types.Address, amount uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	fromAcc := db.load(from)
+	if fromAcc.Amount < amount {
+		return fmt.Errorf("%w: address %x has %d, need %d", ErrInsufficientBalance, from, fromAcc.Amount, amount)
+	}
+	if from == to {
+		return nil
+	}
+	if _, overflow := math.SafeAdd(db.load(to).Amount, amount); overflow {
+		return fmt.Errorf("%w: address %x", ErrBalanceOverflow, to)
+	}
+	if err := db.subBalance(from, amount); err != nil {
+		return err
+	}
+	return db.addBalance(to, amount)
+}
+
+// SetNonce 设置账户的 nonce
+func (db *MockStatDB) SetNonce(addr types.Address, nonce uint64) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	acc := db.load(addr)
+	acc.Nonce = nonce
+	db.store(addr, acc)
+}
+
+// IncNonce 把账户的 nonce 加一，溢出时返回 ErrNonceOverflow
+func (db *MockStatDB) IncNonce(addr types.Address) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	acc := db.load(addr)
+	nonce, overflow := math.SafeAdd(acc.Nonce, 1)
+	if overflow {
+		return fmt.Errorf("%w: address %x", ErrNonceOverflow, addr)
+	}
+	acc.Nonce = nonce
+	db.store(addr, acc)
+	return nil
+}
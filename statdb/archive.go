@@ -0,0 +1,134 @@
+package statdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
+	"hyblockchain/statdb/snapshot"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+var (
+	// ErrNotArchive 表示在非归档模式的数据库上查询历史状态
+	ErrNotArchive = errors.New("statdb: database is not in archive mode")
+	// ErrNoHistory 表示没有该高度的状态记录
+	ErrNoHistory = errors.New("statdb: no state recorded at height")
+	// ErrHeightOrder 表示 UpdateAt 的高度不是下一个要归档的高度
+	ErrHeightOrder = errors.New("statdb: state must be archived at the next height")
+)
+
+// AccountChange 是账户在某个高度的修改，Account 为 nil 表示账户被删除
+type AccountChange struct {
+	Height  uint64
+	Account *types.Account
+}
+
+// NewArchiveDatabase 创建归档模式的状态数据库。归档模式下通过 UpdateAt 提交的
+// 每个状态根都按高度记录下来，同时为每个被修改的账户记录历史，
+// 历史状态的节点永远不会被删除，可以用 StateAt 查询任意高度的状态
+func NewArchiveDatabase(db kvstore.KVStore, snaps *snapshot.Tree) *Database {
+	return &Database{db: db, snaps: snaps, archive: true}
+}
+
+// UpdateAt 和 Update 相同，但把结果记为高度 height 的状态，同样返回这次提交的 BlockDiff。
+// 归档模式下高度索引和账户历史与状态在同一个批次中写入，
+// 高度必须从 0 开始逐个提交，否则返回 ErrHeightOrder
+func (d *Database) UpdateAt(height uint64, root hash.Hash, fn func(state *StateDB) error) (hash.Hash, *BlockDiff, error) {
+	d.writeLock.Lock()
+	defer d.writeLock.Unlock()
+
+	if !d.archive {
+		return d.update(root, fn, nil)
+	}
+	if err := d.checkHeight(height); err != nil {
+		return hash.Hash{}, nil, err
+	}
+	return d.update(root, fn, func(state *StateDB, batch kvstore.Batch) error {
+		return writeHistory(d.db, batch, height, state.committed)
+	})
+}
+
+// checkHeight 检查 height 是下一个要归档的高度：height 还没有记录，且上一个高度已经记录
+func (d *Database) checkHeight(height uint64) error {
+	if _, err := rawdb.ReadStateRoot(d.db, height); !errors.Is(err, kvstore.ErrNotFound) {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: height %d already archived", ErrHeightOrder, height)
+	}
+	if height == 0 {
+		return nil
+	}
+	if _, err := rawdb.ReadStateRoot(d.db, height-1); err != nil {
+		if errors.Is(err, kvstore.ErrNotFound) {
+			return fmt.Errorf("%w: height %d not archived", ErrHeightOrder, height-1)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeHistory 把提交 diff 的账户历史和状态根加入 batch。
+// 编码和块前相同的账户没有变化，块前块后都不存在的账户也不记录
+func writeHistory(db kvstore.KVStore, batch kvstore.Batch, height uint64, diff *stateDiff) error {
+	parent, err := openTrie(db, diff.parent)
+	if err != nil {
+		return err
+	}
+	for addr, data := range diff.accounts {
+		prev, err := parent.Get(addr[:])
+		if err != nil && !errors.Is(err, mpt.ErrNotFound) {
+			return err
+		}
+		if bytes.Equal(prev, data) {
+			continue
+		}
+		rawdb.WriteAccountHistory(batch, addr, height, data)
+	}
+	rawdb.WriteStateRoot(batch, height, diff.root)
+	return nil
+}
+
+// StateAt 返回高度 height 时的只读状态
+func (d *Database) StateAt(height uint64) (StatDB, error) {
+	if !d.archive {
+		return nil, ErrNotArchive
+	}
+	root, err := rawdb.ReadStateRoot(d.db, height)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return nil, fmt.Errorf("%w %d", ErrNoHistory, height)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.View(root)
+}
+
+// AccountHistory 返回账户在高度 [from, to] 之间的全部修改，按高度排序
+func (d *Database) AccountHistory(addr types.Address, from, to uint64) ([]AccountChange, error) {
+	if !d.archive {
+		return nil, ErrNotArchive
+	}
+	var changes []AccountChange
+	err := rawdb.IterateAccountHistory(d.db, addr, from, to, func(number uint64, data []byte) error {
+		change := AccountChange{Height: number}
+		if len(data) > 0 {
+			change.Account = new(types.Account)
+			if err := rlp.DecodeBytes(data, change.Account); err != nil {
+				return err
+			}
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
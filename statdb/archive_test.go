@@ -0,0 +1,147 @@
+package statdb
+
+import (
+	"errors"
+	"testing"
+
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+func TestArchive(t *testing.T) {
+	sdb := NewArchiveDatabase(memorydb.NewMemoryDB(), nil)
+	addr1, addr2 := types.Address{1}, types.Address{2}
+
+	root := hash.Hash{}
+	for height := uint64(0); height < 10; height++ {
+		var err error
+		root, _, err = sdb.UpdateAt(height, root, func(state *StateDB) error {
+			if height == 0 {
+				state.AddBalance(addr2, 1)
+			}
+			if height == 7 {
+				state.Store(addr2, nil)
+			}
+			// addr1 只在偶数高度变化
+			if height%2 == 0 {
+				return state.AddBalance(addr1, 10)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateAt %d failed: %v", height, err)
+		}
+	}
+
+	for height, want := range []uint64{10, 10, 20, 20, 30} {
+		state, err := sdb.StateAt(uint64(height))
+		if err != nil {
+			t.Fatalf("StateAt %d failed: %v", height, err)
+		}
+		if got := state.Load(addr1).Amount; got != want {
+			t.Errorf("Balance at height %d: want %d, got %d", height, want, got)
+		}
+		if err := state.AddBalance(addr1, 1); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Expected historical state to be read-only, got %v", err)
+		}
+	}
+	if _, err := sdb.StateAt(100); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("Expected ErrNoHistory, got %v", err)
+	}
+
+	changes, err := sdb.AccountHistory(addr1, 3, 8)
+	if err != nil {
+		t.Fatalf("AccountHistory failed: %v", err)
+	}
+	if len(changes) != 3 || changes[0].Height != 4 || changes[2].Height != 8 || changes[2].Account.Amount != 50 {
+		t.Errorf("Unexpected history %+v", changes)
+	}
+	changes, err = sdb.AccountHistory(addr2, 0, 100)
+	if err != nil {
+		t.Fatalf("AccountHistory failed: %v", err)
+	}
+	if len(changes) != 2 || changes[1].Height != 7 || changes[1].Account != nil {
+		t.Errorf("Expected creation and deletion of addr2, got %+v", changes)
+	}
+
+	// 块前块后都不存在的账户不产生删除记录，被访问但没有变化的账户不产生记录
+	addr3, addr4 := types.Address{3}, types.Address{4}
+	_, _, err = sdb.UpdateAt(10, root, func(state *StateDB) error {
+		state.SetDeleteEmptyObjects(true)
+		state.AddBalance(addr3, 0)
+		state.AddBalance(addr4, 1)
+		state.DeleteAccount(addr4)
+		state.AddBalance(addr1, 5)
+		return state.SubBalance(addr1, 5)
+	})
+	if err != nil {
+		t.Fatalf("UpdateAt 10 failed: %v", err)
+	}
+	if changes, _ := sdb.AccountHistory(addr1, 9, 10); len(changes) != 0 {
+		t.Errorf("Expected no history for unchanged addr1, got %+v", changes)
+	}
+	for _, addr := range []types.Address{addr3, addr4} {
+		changes, err := sdb.AccountHistory(addr, 0, 100)
+		if err != nil {
+			t.Fatalf("AccountHistory failed: %v", err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("Expected no history for %x, got %+v", addr, changes)
+		}
+	}
+
+	// 高度必须逐个提交，重复或跳过的高度被拒绝
+	for _, height := range []uint64{5, 10, 12} {
+		_, _, err := sdb.UpdateAt(height, root, func(state *StateDB) error {
+			t.Errorf("Expected fn not to run at height %d", height)
+			return nil
+		})
+		if !errors.Is(err, ErrHeightOrder) {
+			t.Errorf("UpdateAt %d: expected ErrHeightOrder, got %v", height, err)
+		}
+	}
+
+	if _, err := NewDatabase(memorydb.NewMemoryDB(), nil).StateAt(0); !errors.Is(err, ErrNotArchive) {
+		t.Errorf("Expected ErrNotArchive, got %v", err)
+	}
+}
+
+// TestArchiveAtomicWrite 检查状态、代码、账户历史和状态根在同一个批次中写入
+func TestArchiveAtomicWrite(t *testing.T) {
+	db := &writeCountingStore{KVStore: memorydb.NewMemoryDB()}
+	sdb := NewArchiveDatabase(db, nil)
+	addr := types.Address{1}
+	update := func(state *StateDB) error {
+		state.SetCode(addr, []byte{0x60, 0x01})
+		state.SetState(addr, hash.Hash{1}, hash.Hash{1})
+		return state.AddBalance(addr, 10)
+	}
+	root, _, err := sdb.UpdateAt(0, hash.Hash{}, update)
+	if err != nil {
+		t.Fatalf("UpdateAt 0 failed: %v", err)
+	}
+	if db.writes != 1 {
+		t.Errorf("Expected a single write, got %d", db.writes)
+	}
+
+	// 写入失败时什么都没有记录，可以重新提交同一高度
+	db.err = errors.New("disk full")
+	if _, _, err := sdb.UpdateAt(1, root, update); !errors.Is(err, db.err) {
+		t.Fatalf("Expected write error, got %v", err)
+	}
+	db.err = nil
+	if _, err := sdb.StateAt(1); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("Expected no state at height 1, got %v", err)
+	}
+	if _, _, err := sdb.UpdateAt(1, root, update); err != nil {
+		t.Fatalf("UpdateAt 1 failed: %v", err)
+	}
+	changes, err := sdb.AccountHistory(addr, 0, 1)
+	if err != nil {
+		t.Fatalf("AccountHistory failed: %v", err)
+	}
+	if len(changes) != 2 || changes[1].Account.Amount != 20 {
+		t.Errorf("Unexpected history %+v", changes)
+	}
+}
@@ -0,0 +1,205 @@
+package statdb
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+
+	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/hexutil"
+	"hyblockchain/utils/rlp"
+)
+
+// BlockDiff 是一次提交对状态的全部修改，可以直接编码为 JSON 或 RLP，
+// 下游按它同步账户而不必重放交易。账户按地址排序
+type BlockDiff struct {
+	ParentRoot hash.Hash      `json:"parentRoot"`
+	Root       hash.Hash      `json:"root"`
+	Accounts   []*AccountDiff `json:"accounts"`
+}
+
+// AccountDiff 是一个账户的修改，没有变化的字段为 nil。
+// 账户被删除或重新创建时，旧的存储项都记为被清零
+type AccountDiff struct {
+	Address types.Address  `json:"address"`
+	Created bool           `json:"created,omitempty"` // 提交前账户不存在
+	Deleted bool           `json:"deleted,omitempty"` // 提交后账户不存在
+	Balance *Uint64Diff    `json:"balance,omitempty" rlp:"nil"`
+	Nonce   *Uint64Diff    `json:"nonce,omitempty" rlp:"nil"`
+	Code    *CodeDiff      `json:"code,omitempty" rlp:"nil"`
+	Storage []*StorageDiff `json:"storage,omitempty"` // 按键排序
+}
+
+// Uint64Diff 是余额或 nonce 的新旧值
+type Uint64Diff struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// CodeDiff 是合约代码的新旧值，没有代码时为空
+type CodeDiff struct {
+	From hexutil.Bytes `json:"from"`
+	To   hexutil.Bytes `json:"to"`
+}
+
+// StorageDiff 是一个存储项的新旧值，零值表示不存在
+type StorageDiff struct {
+	Key  hash.Hash `json:"key"`
+	From hash.Hash `json:"from"`
+	To   hash.Hash `json:"to"`
+}
+
+// BlockDiff 返回上一次 Commit 写入的修改，旧值从提交前的状态树读取。
+// 只被访问而没有变化的账户不会出现在结果中，还没有提交过时返回空的 BlockDiff
+// 通过 Database 提交时使用 Update 和 UpdateAt 返回的 BlockDiff
+func (s *StateDB) BlockDiff() (*BlockDiff, error) {
+	d := s.committed
+	diff := &BlockDiff{ParentRoot: d.parent, Root: d.root}
+	if len(d.accounts) == 0 {
+		return diff, nil
+	}
+	parent, err := openTrie(s.db, d.parent)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]types.Address, 0, len(d.accounts))
+	for addr := range d.accounts {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, func(a, b types.Address) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	for _, addr := range addrs {
+		prev, err := readAccount(parent, addr)
+		if err != nil {
+			return nil, err
+		}
+		var next *types.Account
+		if data := d.accounts[addr]; data != nil {
+			next = new(types.Account)
+			if err := rlp.DecodeBytes(data, next); err != nil {
+				return nil, err
+			}
+		}
+		if prev == nil && next == nil {
+			// 同一次提交中创建又删除的账户
+			continue
+		}
+		account, err := s.accountDiff(addr, prev, next)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil {
+			diff.Accounts = append(diff.Accounts, account)
+		}
+	}
+	return diff, nil
+}
+
+// accountDiff 比较账户提交前后的值，prev 或 next 为 nil 表示账户不存在，
+// 没有任何变化时返回 nil
+func (s *StateDB) accountDiff(addr types.Address, prev, next *types.Account) (*AccountDiff, error) {
+	diff := &AccountDiff{Address: addr, Created: prev == nil, Deleted: next == nil}
+	var from, to types.Account
+	if prev != nil {
+		from = *prev
+	}
+	if next != nil {
+		to = *next
+	}
+	if from.Amount != to.Amount {
+		diff.Balance = &Uint64Diff{From: from.Amount, To: to.Amount}
+	}
+	if from.Nonce != to.Nonce {
+		diff.Nonce = &Uint64Diff{From: from.Nonce, To: to.Nonce}
+	}
+	if from.CodeHash != to.CodeHash {
+		code := new(CodeDiff)
+		var err error
+		if code.From, err = s.readCode(from.CodeHash); err != nil {
+			return nil, err
+		}
+		if code.To, err = s.readCode(to.CodeHash); err != nil {
+			return nil, err
+		}
+		diff.Code = code
+	}
+	storage, err := s.storageDiff(addr, from.Root)
+	if err != nil {
+		return nil, err
+	}
+	diff.Storage = storage
+
+	if !diff.Created && !diff.Deleted && diff.Balance == nil && diff.Nonce == nil &&
+		diff.Code == nil && len(diff.Storage) == 0 {
+		return nil, nil
+	}
+	return diff, nil
+}
+
+// storageDiff 返回账户存储项的变化，root 是提交前的存储树根
+func (s *StateDB) storageDiff(addr types.Address, root hash.Hash) ([]*StorageDiff, error) {
+	d := s.committed
+	_, destructed := d.destructs[addr]
+	if len(d.storage[addr]) == 0 && (!destructed || root == (hash.Hash{})) {
+		return nil, nil
+	}
+	trie, err := openTrie(s.db, root)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[hash.Hash]*StorageDiff)
+	if destructed {
+		// 旧的存储被整体清除
+		err := trie.Iterate(func(key, value []byte) error {
+			k := hash.BytesToHash(key)
+			changes[k] = &StorageDiff{Key: k, From: hash.BytesToHash(value)}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range d.storage[addr] {
+		change, ok := changes[key]
+		if !ok {
+			change = &StorageDiff{Key: key}
+			if !destructed {
+				prev, err := trie.Get(key[:])
+				if err != nil && !errors.Is(err, mpt.ErrNotFound) {
+					return nil, err
+				}
+				change.From = hash.BytesToHash(prev)
+			}
+			changes[key] = change
+		}
+		change.To = hash.BytesToHash(value)
+	}
+
+	var storage []*StorageDiff
+	for _, change := range changes {
+		if change.From != change.To {
+			storage = append(storage, change)
+		}
+	}
+	slices.SortFunc(storage, func(a, b *StorageDiff) int {
+		return bytes.Compare(a.Key[:], b.Key[:])
+	})
+	return storage, nil
+}
+
+// readCode 读取代码哈希对应的代码，哈希为零值时返回 nil
+func (s *StateDB) readCode(codeHash hash.Hash) ([]byte, error) {
+	if codeHash == (hash.Hash{}) {
+		return nil, nil
+	}
+	if code, ok := s.codeCache[codeHash]; ok {
+		return code, nil
+	}
+	return rawdb.ReadCode(s.db, codeHash)
+}
@@ -0,0 +1,178 @@
+package statdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/statdb/snapshot"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+func TestBlockDiff(t *testing.T) {
+	state, err := NewStateDB(memorydb.NewMemoryDB(), hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	if diff, err := state.BlockDiff(); err != nil || len(diff.Accounts) != 0 {
+		t.Fatalf("Expected empty diff before commit, got %+v, %v", diff, err)
+	}
+
+	alice, bob, carol, idle := types.Address{1}, types.Address{2}, types.Address{3}, types.Address{4}
+	state.AddBalance(alice, 100)
+	state.SetCode(alice, []byte{0x60})
+	state.SetState(alice, hash.Hash{1}, hash.Hash{1})
+	state.SetState(alice, hash.Hash{2}, hash.Hash{2})
+	state.AddBalance(carol, 10)
+	state.SetState(carol, hash.Hash{1}, hash.Hash{7})
+	state.AddBalance(idle, 1)
+	root1 := mustCommit(t, state)
+
+	diff, err := state.BlockDiff()
+	if err != nil {
+		t.Fatalf("BlockDiff failed: %v", err)
+	}
+	if diff.Root != root1 || len(diff.Accounts) != 3 {
+		t.Fatalf("Unexpected diff %+v", diff)
+	}
+	if acc := diff.Accounts[0]; !acc.Created || acc.Address != alice || *acc.Balance != (Uint64Diff{0, 100}) ||
+		acc.Code == nil || !bytes.Equal(acc.Code.To, []byte{0x60}) || len(acc.Storage) != 2 {
+		t.Errorf("Unexpected created account %+v", acc)
+	}
+
+	// 第二个区块：转账、修改存储、删除账户，只读的账户不出现在结果中
+	state.Transfer(alice, bob, 30)
+	state.IncNonce(alice)
+	state.SetState(alice, hash.Hash{1}, hash.Hash{9})
+	state.SetState(alice, hash.Hash{2}, hash.Hash{})
+	state.DeleteAccount(carol)
+	state.Load(idle)
+	state.AddBalance(idle, 0)
+	root2 := mustCommit(t, state)
+
+	diff, err = state.BlockDiff()
+	if err != nil {
+		t.Fatalf("BlockDiff failed: %v", err)
+	}
+	if diff.ParentRoot != root1 || diff.Root != root2 || len(diff.Accounts) != 3 {
+		t.Fatalf("Unexpected diff %+v", diff)
+	}
+	a, b, c := diff.Accounts[0], diff.Accounts[1], diff.Accounts[2]
+	if a.Address != alice || a.Created || *a.Balance != (Uint64Diff{100, 70}) || *a.Nonce != (Uint64Diff{0, 1}) || a.Code != nil {
+		t.Errorf("Unexpected alice diff %+v", a)
+	}
+	wantStorage := []StorageDiff{
+		{Key: hash.Hash{1}, From: hash.Hash{1}, To: hash.Hash{9}},
+		{Key: hash.Hash{2}, From: hash.Hash{2}, To: hash.Hash{}},
+	}
+	if len(a.Storage) != len(wantStorage) {
+		t.Fatalf("Unexpected alice storage %+v", a.Storage)
+	}
+	for i, want := range wantStorage {
+		if *a.Storage[i] != want {
+			t.Errorf("Storage %d: got %+v, want %+v", i, *a.Storage[i], want)
+		}
+	}
+	if b.Address != bob || !b.Created || *b.Balance != (Uint64Diff{0, 30}) {
+		t.Errorf("Unexpected bob diff %+v", b)
+	}
+	if c.Address != carol || !c.Deleted || *c.Balance != (Uint64Diff{10, 0}) ||
+		len(c.Storage) != 1 || *c.Storage[0] != (StorageDiff{Key: hash.Hash{1}, From: hash.Hash{7}}) {
+		t.Errorf("Unexpected carol diff %+v", c)
+	}
+
+	// JSON 和 RLP 编码可以还原
+	enc, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	var decJSON BlockDiff
+	if err := json.Unmarshal(enc, &decJSON); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	if reenc, _ := json.Marshal(&decJSON); !bytes.Equal(enc, reenc) {
+		t.Errorf("JSON round trip mismatch:\n%s\n%s", enc, reenc)
+	}
+	enc, err = rlp.EncodeToBytes(diff)
+	if err != nil {
+		t.Fatalf("rlp.EncodeToBytes failed: %v", err)
+	}
+	var decRLP BlockDiff
+	if err := rlp.DecodeBytes(enc, &decRLP); err != nil {
+		t.Fatalf("rlp.DecodeBytes failed: %v", err)
+	}
+	if decRLP.Accounts[0].Code != nil || *decRLP.Accounts[2].Balance != (Uint64Diff{10, 0}) {
+		t.Errorf("Unexpected RLP decoded diff %+v", decRLP.Accounts)
+	}
+	if reenc, _ := rlp.EncodeToBytes(&decRLP); !bytes.Equal(enc, reenc) {
+		t.Errorf("RLP round trip mismatch")
+	}
+}
+
+// TestDatabaseUpdateDiff 检查 Database 的每次提交都返回自己的 BlockDiff，
+// 不依赖某个 StateDB 最后一次 Commit
+func TestDatabaseUpdateDiff(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	snaps, err := snapshot.New(db, hash.Hash{}, false)
+	if err != nil {
+		t.Fatalf("snapshot.New failed: %v", err)
+	}
+	sdb := NewArchiveDatabase(db, snaps)
+	alice, bob := types.Address{1}, types.Address{2}
+
+	root1, diff1, err := sdb.UpdateAt(0, hash.Hash{}, func(state *StateDB) error {
+		state.SetState(alice, hash.Hash{1}, hash.Hash{1})
+		return state.AddBalance(alice, 100)
+	})
+	if err != nil {
+		t.Fatalf("UpdateAt failed: %v", err)
+	}
+	root2, diff2, err := sdb.UpdateAt(1, root1, func(state *StateDB) error {
+		state.SetCode(bob, []byte{0x60})
+		return state.Transfer(alice, bob, 30)
+	})
+	if err != nil {
+		t.Fatalf("UpdateAt failed: %v", err)
+	}
+
+	// 后面的提交不影响前面返回的结果
+	if diff1.Root != root1 || len(diff1.Accounts) != 1 {
+		t.Fatalf("Unexpected first diff %+v", diff1)
+	}
+	if acc := diff1.Accounts[0]; !acc.Created || acc.Address != alice || *acc.Balance != (Uint64Diff{0, 100}) ||
+		len(acc.Storage) != 1 || *acc.Storage[0] != (StorageDiff{Key: hash.Hash{1}, To: hash.Hash{1}}) {
+		t.Errorf("Unexpected account %+v", acc)
+	}
+	if diff2.ParentRoot != root1 || diff2.Root != root2 || len(diff2.Accounts) != 2 {
+		t.Fatalf("Unexpected second diff %+v", diff2)
+	}
+	if acc := diff2.Accounts[0]; acc.Created || acc.Address != alice || *acc.Balance != (Uint64Diff{100, 70}) {
+		t.Errorf("Unexpected sender %+v", acc)
+	}
+	if acc := diff2.Accounts[1]; !acc.Created || acc.Address != bob || *acc.Balance != (Uint64Diff{0, 30}) ||
+		acc.Code == nil || !bytes.Equal(acc.Code.To, []byte{0x60}) {
+		t.Errorf("Unexpected recipient %+v", acc)
+	}
+
+	// 非归档模式的 Update 同样返回 BlockDiff
+	root3, diff3, err := NewDatabase(db, snaps).Update(root2, func(state *StateDB) error {
+		state.DeleteAccount(bob)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if diff3.ParentRoot != root2 || diff3.Root != root3 || len(diff3.Accounts) != 1 || !diff3.Accounts[0].Deleted {
+		t.Errorf("Unexpected diff %+v", diff3)
+	}
+
+	// 没有提交时不返回 BlockDiff
+	failed := errors.New("failed")
+	if _, diff, err := sdb.UpdateAt(2, root2, func(state *StateDB) error { return failed }); !errors.Is(err, failed) || diff != nil {
+		t.Errorf("Expected failed update to return no diff, got %+v, %v", diff, err)
+	}
+}
@@ -0,0 +1,214 @@
+package statdb
+
+import (
+	"errors"
+	"sync"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/statdb/snapshot"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// ErrReadOnly 表示在只读视图上执行了写操作
+var ErrReadOnly = errors.New("statdb: state view is read-only")
+
+// Database 可以在多个协程之间共享。读取者通过 View 获得固定状态根上的
+// 只读视图，写入者通过 Update 在某个状态根之上构建下一个状态，
+// 同一时间只有一个写入者。MPT 节点按哈希寻址且只增不改，
+// 所以写入者提交新状态不会影响正在读取旧状态的视图
+type Database struct {
+	db      kvstore.KVStore
+	snaps   *snapshot.Tree // 可以为 nil
+	archive bool           // 归档模式，见 NewArchiveDatabase
+
+	writeLock sync.Mutex
+}
+
+// NewDatabase 创建共享的状态数据库，snaps 为 nil 时不使用扁平快照
+func NewDatabase(db kvstore.KVStore, snaps *snapshot.Tree) *Database {
+	return &Database{db: db, snaps: snaps}
+}
+
+// open 打开根为 root 的 StateDB
+func (d *Database) open(root hash.Hash) (*StateDB, error) {
+	if d.snaps != nil {
+		return NewStateDBWithSnapshot(d.db, root, d.snaps)
+	}
+	return NewStateDB(d.db, root)
+}
+
+// View 返回根为 root 的只读视图，视图本身也可以被多个协程同时使用
+func (d *Database) View(root hash.Hash) (*StateView, error) {
+	state, err := d.open(root)
+	if err != nil {
+		return nil, err
+	}
+	return &StateView{db: d, state: state}, nil
+}
+
+// Update 在根为 root 的状态上执行 fn 并提交，返回新的状态根和这次提交的 BlockDiff。
+// 同一时间只有一个 Update 在执行，fn 返回错误时不提交。
+// 归档模式下需要记录高度时使用 UpdateAt
+func (d *Database) Update(root hash.Hash, fn func(state *StateDB) error) (hash.Hash, *BlockDiff, error) {
+	d.writeLock.Lock()
+	defer d.writeLock.Unlock()
+
+	return d.update(root, fn, nil)
+}
+
+// update 打开根为 root 的状态，执行 fn 并提交，调用方需持有 writeLock。
+// extra 不为 nil 时把额外的数据加入和状态相同的批次，见 StateDB.commit。
+// BlockDiff 在写入前生成，生成失败时不提交
+func (d *Database) update(root hash.Hash, fn func(state *StateDB) error, extra func(state *StateDB, batch kvstore.Batch) error) (hash.Hash, *BlockDiff, error) {
+	state, err := d.open(root)
+	if err != nil {
+		return hash.Hash{}, nil, err
+	}
+	if err := fn(state); err != nil {
+		return hash.Hash{}, nil, err
+	}
+	var diff *BlockDiff
+	newRoot, err := state.commit(func(batch kvstore.Batch) error {
+		var err error
+		if diff, err = state.BlockDiff(); err != nil {
+			return err
+		}
+		if extra != nil {
+			return extra(state, batch)
+		}
+		return nil
+	})
+	if err != nil {
+		return hash.Hash{}, nil, err
+	}
+	return newRoot, diff, nil
+}
+
+// StateView 是固定状态根上的只读 StatDB，可以被多个协程同时使用。
+// 返回错误的写方法返回 ErrReadOnly，Store 和 SetNonce 被忽略并记录 ErrReadOnly
+type StateView struct {
+	db *Database
+
+	lock  sync.Mutex // StateDB 会在读取时缓存账户和加载节点，需要串行访问
+	state *StateDB
+}
+
+// Root 返回视图的状态根
+func (v *StateView) Root() hash.Hash {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.state.originalRoot
+}
+
+// Load 返回指定地址的账户信息，找不到时返回空账户(Nonce=0)
+func (v *StateView) Load(addr types.Address) *types.Account {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.state.Load(addr)
+}
+
+// GetState 返回账户存储中 key 对应的值
+func (v *StateView) GetState(addr types.Address, key hash.Hash) hash.Hash {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.state.GetState(addr, key)
+}
+
+// GetCode 返回账户的合约代码
+func (v *StateView) GetCode(addr types.Address) []byte {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return append([]byte{}, v.state.GetCode(addr)...)
+}
+
+// GetCodeSize 返回账户合约代码的长度
+func (v *StateView) GetCodeSize(addr types.Address) int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.state.GetCodeSize(addr)
+}
+
+// GetCodeHash 返回账户合约代码的哈希
+func (v *StateView) GetCodeHash(addr types.Address) hash.Hash {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.state.GetCodeHash(addr)
+}
+
+// SetRoot 把视图切换到根为 root 的状态
+func (v *StateView) SetRoot(root hash.Hash) {
+	state, err := v.db.open(root)
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if err != nil {
+		v.state.setError(err)
+		return
+	}
+	v.state = state
+}
+
+// SetStatRoot 是 SetRoot 的别名，兼容接口
+func (v *StateView) SetStatRoot(root hash.Hash) {
+	v.SetRoot(root)
+}
+
+// Error 返回读取过程中记录的第一个错误
+func (v *StateView) Error() error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	return v.state.Error()
+}
+
+// Store 在只读视图上不做任何修改
+func (v *StateView) Store(addr types.Address, account *types.Account) {
+	v.readOnly()
+}
+
+// DeleteAccount 在只读视图上不做任何修改，总是返回 false
+func (v *StateView) DeleteAccount(addr types.Address) bool {
+	v.readOnly()
+	return false
+}
+
+// SetNonce 在只读视图上不做任何修改
+func (v *StateView) SetNonce(addr types.Address, nonce uint64) {
+	v.readOnly()
+}
+
+// AddBalance 在只读视图上返回 ErrReadOnly
+func (v *StateView) AddBalance(addr types.Address, amount uint64) error {
+	return ErrReadOnly
+}
+
+// SubBalance 在只读视图上返回 ErrReadOnly
+func (v *StateView) SubBalance(addr types.Address, amount uint64) error {
+	return ErrReadOnly
+}
+
+// Transfer 在只读视图上返回 ErrReadOnly
+func (v *StateView) Transfer(from, to types.Address, amount uint64) error {
+	return ErrReadOnly
+}
+
+// IncNonce 在只读视图上返回 ErrReadOnly
+func (v *StateView) IncNonce(addr types.Address) error {
+	return ErrReadOnly
+}
+
+// readOnly 记录一次被忽略的写操作
+func (v *StateView) readOnly() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.state.setError(ErrReadOnly)
+}
@@ -0,0 +1,209 @@
+package statdb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/rawdb"
+	"hyblockchain/statdb/snapshot"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// TestDatabaseConcurrent 在一个写入者不断转账的同时让多个读取者读取已提交的状态，
+// 每个状态中的余额总和都必须不变。区块数超过内存中保留的快照层数，
+// 读取的同时会把差异层合并到磁盘层。需要用 go test -race 运行
+func TestDatabaseConcurrent(t *testing.T) {
+	const (
+		accounts = 8
+		blocks   = 2 * snapshotLayers
+		readers  = 8
+		initial  = 1000
+	)
+	db := memorydb.NewMemoryDB()
+	snaps, err := snapshot.New(db, hash.Hash{}, false)
+	if err != nil {
+		t.Fatalf("snapshot.New failed: %v", err)
+	}
+	sdb := NewDatabase(db, snaps)
+
+	root, _, err := sdb.Update(hash.Hash{}, func(state *StateDB) error {
+		for i := 0; i < accounts; i++ {
+			if err := state.AddBalance(types.Address{byte(i)}, initial); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	var (
+		lock  sync.Mutex
+		roots = []hash.Hash{root}
+		done  = make(chan struct{})
+		wg    sync.WaitGroup
+		errs  = make(chan error, readers+1)
+	)
+	latest := func() hash.Hash {
+		lock.Lock()
+		defer lock.Unlock()
+		return roots[len(roots)-1]
+	}
+
+	// 写入者
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		root := latest()
+		for b := 0; b < blocks; b++ {
+			next, _, err := sdb.Update(root, func(state *StateDB) error {
+				from, to := types.Address{byte(b % accounts)}, types.Address{byte((b + 3) % accounts)}
+				return state.Transfer(from, to, uint64(b))
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			root = next
+			lock.Lock()
+			roots = append(roots, root)
+			lock.Unlock()
+		}
+	}()
+
+	// 读取者，一部分共享同一个视图
+	shared, err := sdb.View(root)
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				view := shared
+				if r%2 == 0 {
+					v, err := sdb.View(latest())
+					if err != nil {
+						errs <- err
+						return
+					}
+					view = v
+				}
+				var total uint64
+				for i := 0; i < accounts; i++ {
+					total += view.Load(types.Address{byte(i)}).Amount
+				}
+				if total != accounts*initial {
+					errs <- errors.New("total balance changed")
+					return
+				}
+				if err := view.Error(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	// 差异层已经被合并到磁盘层
+	if diskRoot, err := rawdb.ReadSnapshotRoot(db); err != nil || diskRoot != roots[len(roots)-1-snapshotLayers] {
+		t.Errorf("Expected snapshot layers to be flattened, disk root %x, %v", diskRoot, err)
+	}
+
+	// 旧状态仍然可以读取
+	view, err := sdb.View(roots[0])
+	if err != nil {
+		t.Fatalf("View at first root failed: %v", err)
+	}
+	if acc := view.Load(types.Address{0}); acc.Amount != initial {
+		t.Errorf("Expected old state to be unchanged, got %+v", acc)
+	}
+	if err := view.AddBalance(types.Address{0}, 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
+
+// writeCountingStore 统计对底层数据库的写入次数，err 不为 nil 时批量写入失败
+type writeCountingStore struct {
+	kvstore.KVStore
+	writes int
+	err    error
+}
+
+func (w *writeCountingStore) Put(key []byte, value []byte) error {
+	w.writes++
+	return w.KVStore.Put(key, value)
+}
+
+func (w *writeCountingStore) Delete(key []byte) error {
+	w.writes++
+	return w.KVStore.Delete(key)
+}
+
+func (w *writeCountingStore) Write(batch kvstore.Batch) error {
+	w.writes++
+	if w.err != nil {
+		return w.err
+	}
+	return w.KVStore.Write(batch)
+}
+
+// TestDatabaseReadsWriteNothing 检查只读打开状态不会写入数据库
+func TestDatabaseReadsWriteNothing(t *testing.T) {
+	db := &writeCountingStore{KVStore: memorydb.NewMemoryDB()}
+	sdb := NewArchiveDatabase(db, nil)
+	addr := types.Address{1}
+	root, _, err := sdb.UpdateAt(0, hash.Hash{}, func(state *StateDB) error {
+		return state.AddBalance(addr, 10)
+	})
+	if err != nil {
+		t.Fatalf("UpdateAt failed: %v", err)
+	}
+	db.writes = 0
+
+	for _, r := range []hash.Hash{{}, root} {
+		view, err := sdb.View(r)
+		if err != nil {
+			t.Fatalf("View failed: %v", err)
+		}
+		view.Load(addr)
+		view.GetState(addr, hash.Hash{1})
+		view.GetState(types.Address{2}, hash.Hash{1})
+		if err := view.Error(); err != nil {
+			t.Errorf("Unexpected view error: %v", err)
+		}
+	}
+	state, err := sdb.StateAt(0)
+	if err != nil {
+		t.Fatalf("StateAt failed: %v", err)
+	}
+	state.Load(types.Address{2})
+	dry, err := NewDryRunState(db, hash.Hash{}, nil)
+	if err != nil {
+		t.Fatalf("NewDryRunState on empty state failed: %v", err)
+	}
+	dry.AddBalance(addr, 1)
+	dry.IntermediateRoot()
+	if err := dry.Error(); err != nil {
+		t.Errorf("Unexpected dry-run error: %v", err)
+	}
+	if db.writes != 0 {
+		t.Errorf("Expected reads to leave the database unchanged, got %d writes", db.writes)
+	}
+}
@@ -0,0 +1,49 @@
+package statdb
+
+import (
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// stateDiff 记录两次提交之间账户和存储的修改，提交时作为快照的差异层，
+// 归档模式下还用来写入账户历史
+type stateDiff struct {
+	parent, root hash.Hash // 提交前后的状态根，提交时填写
+
+	destructs map[types.Address]struct{}             // 存储被整体清除的账户
+	accounts  map[types.Address][]byte               // 账户的 RLP 编码，nil 表示删除
+	storage   map[types.Address]map[hash.Hash][]byte // 存储值，nil 表示删除
+}
+
+func newStateDiff() *stateDiff {
+	return &stateDiff{
+		destructs: make(map[types.Address]struct{}),
+		accounts:  make(map[types.Address][]byte),
+		storage:   make(map[types.Address]map[hash.Hash][]byte),
+	}
+}
+
+// destruct 记录账户被删除或重新创建，之前记录的存储修改随之作废
+func (d *stateDiff) destruct(addr types.Address) {
+	d.destructs[addr] = struct{}{}
+	delete(d.storage, addr)
+}
+
+// updateAccount 记录账户的新编码，data 为 nil 表示删除
+func (d *stateDiff) updateAccount(addr types.Address, data []byte) {
+	d.accounts[addr] = data
+}
+
+// updateStorage 记录存储项的新值，零值表示删除
+func (d *stateDiff) updateStorage(addr types.Address, key, value hash.Hash) {
+	slots, ok := d.storage[addr]
+	if !ok {
+		slots = make(map[hash.Hash][]byte)
+		d.storage[addr] = slots
+	}
+	if value == (hash.Hash{}) {
+		slots[key] = nil
+	} else {
+		slots[key] = value.Bytes()
+	}
+}
@@ -0,0 +1,96 @@
+package statdb
+
+import (
+	"encoding/json"
+	"io"
+	"iter"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/mpt"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+// DumpConfig 控制导出的内容
+type DumpConfig struct {
+	Storage bool // 是否导出每个账户的存储项
+}
+
+// DumpAccount 是状态导出中的一个账户
+type DumpAccount struct {
+	Address  types.Address           `json:"address"`
+	Balance  uint64                  `json:"balance"`
+	Nonce    uint64                  `json:"nonce"`
+	CodeHash hash.Hash               `json:"codeHash"`
+	Root     hash.Hash               `json:"root"`
+	Storage  map[hash.Hash]hash.Hash `json:"storage,omitempty"`
+}
+
+// IterateAccounts 按地址顺序遍历 db 中根为 root 的状态的全部账户。
+// 遍历出错时产出一次错误后结束
+func IterateAccounts(db kvstore.KVStore, root hash.Hash, cfg DumpConfig) iter.Seq2[*DumpAccount, error] {
+	return func(yield func(*DumpAccount, error) bool) {
+		trie, err := openTrie(db, root)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		err = trie.Iterate(func(key, value []byte) error {
+			var account types.Account
+			if err := rlp.DecodeBytes(value, &account); err != nil {
+				return err
+			}
+			dump := &DumpAccount{
+				Balance:  account.Amount,
+				Nonce:    account.Nonce,
+				CodeHash: account.CodeHash,
+				Root:     account.Root,
+			}
+			copy(dump.Address[:], key)
+			if cfg.Storage {
+				if dump.Storage, err = dumpStorage(db, account.Root); err != nil {
+					return err
+				}
+			}
+			if !yield(dump, nil) {
+				return mpt.ErrStopIteration
+			}
+			return nil
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// dumpStorage 读取根为 root 的存储树中的全部存储项
+func dumpStorage(db kvstore.KVStore, root hash.Hash) (map[hash.Hash]hash.Hash, error) {
+	storage := make(map[hash.Hash]hash.Hash)
+	if root == (hash.Hash{}) {
+		return storage, nil
+	}
+	trie, err := openTrie(db, root)
+	if err != nil {
+		return nil, err
+	}
+	err = trie.Iterate(func(key, value []byte) error {
+		storage[hash.BytesToHash(key)] = hash.BytesToHash(value)
+		return nil
+	})
+	return storage, err
+}
+
+// Dump 把根为 root 的状态以每行一个账户的 JSON 格式写入 w
+func Dump(db kvstore.KVStore, root hash.Hash, cfg DumpConfig, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for account, err := range IterateAccounts(db, root, cfg) {
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package statdb
+
+import (
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// journalEntry 是一次可以撤销的状态修改
+type journalEntry interface {
+	// revert 撤销这次修改
+	revert(s *StateDB)
+	// address 返回被修改的账户
+	address() types.Address
+}
+
+// journal 按顺序记录状态修改，用于回滚到某个快照
+type journal struct {
+	entries []journalEntry
+	dirties map[types.Address]int // 账户 -> 对应的修改条数
+}
+
+func newJournal() *journal {
+	return &journal{dirties: make(map[types.Address]int)}
+}
+
+// append 记录一次修改
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+	j.dirties[entry.address()]++
+}
+
+// revert 按相反顺序撤销 snapshot 之后的修改
+func (j *journal) revert(s *StateDB, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		entry := j.entries[i]
+		entry.revert(s)
+
+		addr := entry.address()
+		if j.dirties[addr]--; j.dirties[addr] == 0 {
+			delete(j.dirties, addr)
+		}
+	}
+	j.entries = j.entries[:snapshot]
+}
+
+// length 返回当前的修改条数
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+type (
+	// createObjectChange 记录账户的创建，prev 是之前缓存的（已删除的）账户
+	createObjectChange struct {
+		account types.Address
+		prev    *stateObject
+	}
+	// accountChange 记录对已有账户的整体覆盖或删除
+	accountChange struct {
+		account     types.Address
+		prev        types.Account
+		prevDeleted bool
+	}
+	// balanceChange 记录对余额的修改
+	balanceChange struct {
+		account types.Address
+		prev    uint64
+	}
+	// nonceChange 记录对 nonce 的修改
+	nonceChange struct {
+		account types.Address
+		prev    uint64
+	}
+	// storageChange 记录对一个存储项的修改，prevDirty 表示修改前该项是否已经被修改过
+	storageChange struct {
+		account   types.Address
+		key       hash.Hash
+		prev      hash.Hash
+		prevDirty bool
+	}
+	// codeChange 记录对合约代码的修改
+	codeChange struct {
+		account  types.Address
+		prevCode []byte
+		prevHash hash.Hash
+	}
+)
+
+func (ch createObjectChange) revert(s *StateDB) {
+	if ch.prev == nil {
+		delete(s.objects, ch.account)
+	} else {
+		s.objects[ch.account] = ch.prev
+	}
+}
+
+func (ch createObjectChange) address() types.Address {
+	return ch.account
+}
+
+func (ch accountChange) revert(s *StateDB) {
+	obj := s.objects[ch.account]
+	obj.data = ch.prev
+	obj.deleted = ch.prevDeleted
+}
+
+func (ch accountChange) address() types.Address {
+	return ch.account
+}
+
+func (ch storageChange) revert(s *StateDB) {
+	obj := s.objects[ch.account]
+	if ch.prevDirty {
+		obj.dirtyStorage[ch.key] = ch.prev
+	} else {
+		delete(obj.dirtyStorage, ch.key)
+	}
+}
+
+func (ch storageChange) address() types.Address {
+	return ch.account
+}
+
+func (ch codeChange) revert(s *StateDB) {
+	obj := s.objects[ch.account]
+	obj.code = ch.prevCode
+	obj.data.CodeHash = ch.prevHash
+}
+
+func (ch codeChange) address() types.Address {
+	return ch.account
+}
+
+func (ch balanceChange) revert(s *StateDB) {
+	s.objects[ch.account].data.Amount = ch.prev
+}
+
+func (ch balanceChange) address() types.Address {
+	return ch.account
+}
+
+func (ch nonceChange) revert(s *StateDB) {
+	s.objects[ch.account].data.Nonce = ch.prev
+}
+
+func (ch nonceChange) address() types.Address {
+	return ch.account
+}
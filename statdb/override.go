@@ -0,0 +1,116 @@
+package statdb
+
+import (
+	"fmt"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/hexutil"
+	"hyblockchain/utils/math"
+)
+
+// OverrideAccount 描述试运行时要覆盖的账户字段，为 nil 的字段保持原值。
+// State 替换账户的全部存储，StateDiff 只修改给定的存储项，两者不能同时使用
+type OverrideAccount struct {
+	Balance   *math.HexOrDecimal64    `json:"balance,omitempty"`
+	Nonce     *math.HexOrDecimal64    `json:"nonce,omitempty"`
+	Code      *hexutil.Bytes          `json:"code,omitempty"`
+	State     map[hash.Hash]hash.Hash `json:"state,omitempty"`
+	StateDiff map[hash.Hash]hash.Hash `json:"stateDiff,omitempty"`
+}
+
+// empty 判断是否没有覆盖任何字段
+func (o *OverrideAccount) empty() bool {
+	return o.Balance == nil && o.Nonce == nil && o.Code == nil && o.State == nil && len(o.StateDiff) == 0
+}
+
+// StateOverride 是地址到覆盖字段的映射
+type StateOverride map[types.Address]OverrideAccount
+
+// NewDryRunState 打开根为 root 的一次性状态并应用 overrides，用于手续费估算
+// 和假设分析。可以在上面执行交易、计算 IntermediateRoot，但所有修改只保存在内存中，
+// 底层 db 不会被写入，Commit 会返回 ErrReadOnly
+func NewDryRunState(db kvstore.KVStore, root hash.Hash, overrides StateOverride) (*StateDB, error) {
+	state, err := NewStateDB(&readOnlyStore{db: db, txs: kvstore.NewTxTracker()}, root)
+	if err != nil {
+		return nil, err
+	}
+	for addr, override := range overrides {
+		if override.State != nil && override.StateDiff != nil {
+			return nil, fmt.Errorf("statdb: override for %x has both state and stateDiff", addr)
+		}
+		if override.empty() {
+			// 什么都不覆盖时不能创建账户，否则会改变状态根
+			continue
+		}
+		obj := state.getOrNewObject(addr)
+		if override.Balance != nil {
+			state.setBalance(obj, uint64(*override.Balance))
+		}
+		if override.Nonce != nil {
+			state.SetNonce(addr, uint64(*override.Nonce))
+		}
+		if override.Code != nil {
+			state.SetCode(addr, *override.Code)
+		}
+		if override.State != nil {
+			state.journal.append(accountChange{account: addr, prev: obj.data})
+			obj.resetStorage(state)
+			for key, value := range override.State {
+				state.SetState(addr, key, value)
+			}
+		}
+		for key, value := range override.StateDiff {
+			state.SetState(addr, key, value)
+		}
+	}
+	// 覆盖的值写进内存中的状态树，试运行中的快照无法回滚到覆盖之前
+	if state.IntermediateRoot(); state.Error() != nil {
+		return nil, state.Error()
+	}
+	return state, nil
+}
+
+// readOnlyStore 是拒绝一切写入的 KVStore 装饰器
+type readOnlyStore struct {
+	db  kvstore.KVStore
+	txs *kvstore.TxTracker
+}
+
+func (r *readOnlyStore) Get(key []byte) ([]byte, error) {
+	return r.db.Get(key)
+}
+
+func (r *readOnlyStore) Has(key []byte) (bool, error) {
+	return r.db.Has(key)
+}
+
+func (r *readOnlyStore) Put(key []byte, value []byte) error {
+	return ErrReadOnly
+}
+
+func (r *readOnlyStore) Delete(key []byte) error {
+	return ErrReadOnly
+}
+
+func (r *readOnlyStore) Batch() kvstore.Batch {
+	return r.db.Batch()
+}
+
+func (r *readOnlyStore) Write(batch kvstore.Batch) error {
+	return ErrReadOnly
+}
+
+func (r *readOnlyStore) NewIterator(prefix []byte) kvstore.Iterator {
+	return r.db.NewIterator(prefix)
+}
+
+func (r *readOnlyStore) Begin() kvstore.Transaction {
+	return r.txs.Begin(r, r.Write)
+}
+
+// Close 不关闭底层存储，底层存储仍由调用方管理
+func (r *readOnlyStore) Close() error {
+	return nil
+}
@@ -0,0 +1,87 @@
+package statdb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/hexutil"
+	"hyblockchain/utils/math"
+)
+
+func TestDryRunState(t *testing.T) {
+	db := memorydb.NewMemoryDB().(*memorydb.MemoryDB)
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr1, addr2 := types.Address{1}, types.Address{2}
+	state.AddBalance(addr1, 10)
+	state.SetState(addr1, hash.Hash{1}, hash.Hash{1})
+	state.SetState(addr1, hash.Hash{2}, hash.Hash{2})
+	root := mustCommit(t, state)
+	entries := db.Len()
+
+	balance := math.HexOrDecimal64(1000)
+	nonce := math.HexOrDecimal64(5)
+	code := hexutil.Bytes{0x60, 0x00}
+	dry, err := NewDryRunState(db, root, StateOverride{
+		addr1: {Balance: &balance, State: map[hash.Hash]hash.Hash{{3}: {3}}},
+		addr2: {Nonce: &nonce, Code: &code},
+	})
+	if err != nil {
+		t.Fatalf("NewDryRunState failed: %v", err)
+	}
+
+	if acc := dry.Load(addr1); acc.Amount != 1000 {
+		t.Errorf("Expected overridden balance, got %+v", acc)
+	}
+	if got := dry.GetState(addr1, hash.Hash{1}); got != (hash.Hash{}) {
+		t.Errorf("Expected storage to be replaced, got %x", got)
+	}
+	if got := dry.GetState(addr1, hash.Hash{3}); got != (hash.Hash{3}) {
+		t.Errorf("Expected overridden storage, got %x", got)
+	}
+	if acc := dry.Load(addr2); acc.Nonce != 5 || !bytes.Equal(dry.GetCode(addr2), code) {
+		t.Errorf("Unexpected addr2 %+v with code %x", acc, dry.GetCode(addr2))
+	}
+
+	// 执行交易并计算根哈希，但不能写入数据库
+	if err := dry.Transfer(addr1, addr2, 600); err != nil {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+	dry.IntermediateRoot()
+	if _, err := dry.Commit(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected Commit to fail with ErrReadOnly, got %v", err)
+	}
+	if db.Len() != entries {
+		t.Errorf("Dry run wrote %d entries to the database", db.Len()-entries)
+	}
+
+	// 原状态不受影响
+	state, err = NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	if acc := state.Load(addr1); acc.Amount != 10 {
+		t.Errorf("Expected original balance, got %+v", acc)
+	}
+	if got := state.GetState(addr1, hash.Hash{1}); got != (hash.Hash{1}) {
+		t.Errorf("Expected original storage, got %x", got)
+	}
+
+	// 没有覆盖任何字段的条目不会创建账户
+	dry, err = NewDryRunState(db, root, StateOverride{
+		types.Address{9}: {},
+		addr2:            {StateDiff: map[hash.Hash]hash.Hash{}},
+	})
+	if err != nil {
+		t.Fatalf("NewDryRunState failed: %v", err)
+	}
+	if got := dry.IntermediateRoot(); got != root {
+		t.Errorf("Empty overrides changed the root: got %x, want %x", got, root)
+	}
+}
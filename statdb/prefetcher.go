@@ -0,0 +1,200 @@
+package statdb
+
+import (
+	"runtime"
+	"sync"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// prefetchTask 是一次预取请求
+type prefetchTask struct {
+	addr types.Address
+	keys []hash.Hash
+}
+
+// Prefetcher 在后台用多个协程并行读取根为 root 的状态中即将被访问的账户、
+// 存储和代码。预取不保存读取结果，而是通过 db 读取：db 应当是执行交易时
+// 打开 StateDB 用的同一个带缓存的存储（如 cachedb.CacheDB），读到的状态树节点
+// 和代码留在它的缓存中，之后在 db 上打开的任何 StateDB 读取这些数据时都直接命中缓存。
+// 使用扁平快照时读取走快照，预取的是状态树节点，作用有限。
+// 预取只是加速读取，读取失败的数据会被跳过
+type Prefetcher struct {
+	db   kvstore.KVStore
+	root hash.Hash
+	wg   sync.WaitGroup
+
+	lock    sync.Mutex
+	cond    *sync.Cond // 新任务、任务完成和关闭时广播
+	queue   []prefetchTask
+	pending int // 尚未完成的任务数，包括正在执行的任务
+	closed  bool
+}
+
+// NewPrefetcher 创建一个预取根为 root 的状态的 Prefetcher，并启动 workers 个协程，
+// workers 不大于零时使用 CPU 核数。使用完毕后需要调用 Close
+func NewPrefetcher(db kvstore.KVStore, root hash.Hash, workers int) *Prefetcher {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	p := &Prefetcher{db: db, root: root}
+	p.cond = sync.NewCond(&p.lock)
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go p.loop()
+	}
+	return p
+}
+
+// Root 返回预取的状态根
+func (p *Prefetcher) Root() hash.Hash {
+	return p.root
+}
+
+// Prefetch 在后台读取账户、账户的代码以及 keys 对应的存储项，不会阻塞调用方
+func (p *Prefetcher) Prefetch(addr types.Address, keys ...hash.Hash) {
+	p.schedule(prefetchTask{addr: addr, keys: keys})
+}
+
+// PrefetchTx 在后台读取交易的发送方 from 和接收方账户以及接收方的代码。
+// from 由调用方在验证签名时恢复，预取不做签名恢复。
+// 交易不声明会访问哪些存储，合约存储需要通过 Prefetch 指定
+func (p *Prefetcher) PrefetchTx(from types.Address, tx *types.Transaction) {
+	p.schedule(prefetchTask{addr: from})
+	p.schedule(prefetchTask{addr: tx.To})
+}
+
+// Wait 等待已经提交的任务全部完成，Prefetcher 关闭后只等待正在执行的任务退出
+func (p *Prefetcher) Wait() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for p.pending > 0 {
+		p.cond.Wait()
+	}
+}
+
+// Close 取消尚未完成的任务并等待后台协程退出，可以重复调用。
+// 已经读入缓存的数据不受影响
+func (p *Prefetcher) Close() {
+	p.lock.Lock()
+	if !p.closed {
+		p.closed = true
+		p.pending -= len(p.queue)
+		p.queue = nil
+		p.cond.Broadcast()
+	}
+	p.lock.Unlock()
+
+	p.wg.Wait()
+}
+
+// schedule 把任务加入队列，Prefetcher 已关闭时丢弃任务
+func (p *Prefetcher) schedule(task prefetchTask) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.queue = append(p.queue, task)
+	p.pending++
+	p.cond.Signal()
+}
+
+// next 取出下一个任务，Prefetcher 关闭后返回 false
+func (p *Prefetcher) next() (prefetchTask, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for len(p.queue) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return prefetchTask{}, false
+	}
+	task := p.queue[0]
+	p.queue = p.queue[1:]
+	return task, true
+}
+
+// done 标记一个任务完成
+func (p *Prefetcher) done() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.pending--; p.pending == 0 {
+		p.cond.Broadcast()
+	}
+}
+
+// isClosed 判断 Prefetcher 是否已经关闭，执行中的任务据此提前退出
+func (p *Prefetcher) isClosed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.closed
+}
+
+// loop 是后台协程的主循环。MPT 不是并发安全的，每个协程打开自己的状态树
+func (p *Prefetcher) loop() {
+	defer p.wg.Done()
+
+	w := &prefetchWorker{p: p, storage: make(map[hash.Hash]*mpt.MPT)}
+	for {
+		task, ok := p.next()
+		if !ok {
+			return
+		}
+		w.fetch(task.addr, task.keys)
+		p.done()
+	}
+}
+
+// prefetchWorker 是一个后台协程私有的状态树
+type prefetchWorker struct {
+	p       *Prefetcher
+	trie    *mpt.MPT
+	storage map[hash.Hash]*mpt.MPT // 存储树根 -> 存储树
+}
+
+// fetch 沿状态树读取账户、代码和存储项
+func (w *prefetchWorker) fetch(addr types.Address, keys []hash.Hash) {
+	if w.p.isClosed() {
+		return
+	}
+	if w.trie == nil {
+		trie, err := openTrie(w.p.db, w.p.root)
+		if err != nil {
+			return
+		}
+		w.trie = trie
+	}
+	account, err := readAccount(w.trie, addr)
+	if err != nil || account == nil {
+		return
+	}
+	if account.CodeHash != (hash.Hash{}) {
+		rawdb.ReadCode(w.p.db, account.CodeHash)
+	}
+	if len(keys) == 0 || account.Root == (hash.Hash{}) {
+		return
+	}
+	trie, ok := w.storage[account.Root]
+	if !ok {
+		if trie, err = openTrie(w.p.db, account.Root); err != nil {
+			return
+		}
+		w.storage[account.Root] = trie
+	}
+	for _, key := range keys {
+		if w.p.isClosed() {
+			return
+		}
+		trie.Get(key[:])
+	}
+}
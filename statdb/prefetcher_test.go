@@ -0,0 +1,130 @@
+package statdb
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+
+	"hyblockchain/crypto/secp256k1"
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/cachedb"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// countingStore 统计对底层数据库的读取次数
+type countingStore struct {
+	kvstore.KVStore
+	reads atomic.Int64
+}
+
+func (c *countingStore) Get(key []byte) ([]byte, error) {
+	c.reads.Add(1)
+	return c.KVStore.Get(key)
+}
+
+func TestPrefetcher(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	contract, missing := types.Address{1}, types.Address{2}
+	priv, _ := secp256k1.GenerateKey()
+	tx, err := types.NewTransactionWithSigner(contract, 0, 21000, 1, 1, priv)
+	if err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	sender := tx.From()
+	state.AddBalance(sender, 100)
+	state.SetCode(contract, []byte{0x60, 0x01})
+	state.SetState(contract, hash.Hash{1}, hash.Hash{1})
+	state.SetState(contract, hash.Hash{2}, hash.Hash{2})
+	state.SetState(contract, hash.Hash{3}, hash.Hash{3})
+	root := mustCommit(t, state)
+
+	// 没有预取时执行需要读取底层存储
+	store := &countingStore{KVStore: db}
+	cold, err := NewStateDB(cachedb.NewCacheDB(store, 1<<20), root)
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	cold.Load(sender)
+	if store.reads.Load() == 0 {
+		t.Fatalf("Expected a cold cache to read the database")
+	}
+
+	cache := cachedb.NewCacheDB(store, 1<<20)
+	p := NewPrefetcher(cache, root, 4)
+	defer p.Close()
+	p.PrefetchTx(sender, tx)
+	p.Prefetch(contract, hash.Hash{1}, hash.Hash{2}, hash.Hash{4})
+	p.Prefetch(missing)
+	p.Wait()
+
+	// 执行时在同一个缓存上打开的 StateDB 读取预取过的数据不再访问底层存储
+	store.reads.Store(0)
+	state, err = NewStateDB(cache, root)
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	if acc := state.Load(sender); acc.Amount != 100 {
+		t.Errorf("Unexpected sender %+v", acc)
+	}
+	if acc := state.Load(missing); *acc != (types.Account{}) {
+		t.Errorf("Expected missing account, got %+v", acc)
+	}
+	if code := state.GetCode(contract); !bytes.Equal(code, []byte{0x60, 0x01}) {
+		t.Errorf("Unexpected code %x", code)
+	}
+	for _, key := range []hash.Hash{{1}, {2}} {
+		if got := state.GetState(contract, key); got != key {
+			t.Errorf("GetState(%x): got %x", key, got)
+		}
+	}
+	if got := state.GetState(contract, hash.Hash{4}); got != (hash.Hash{}) {
+		t.Errorf("Expected empty slot, got %x", got)
+	}
+	if n := store.reads.Load(); n != 0 {
+		t.Errorf("Expected prefetched reads to hit the cache, got %d database reads", n)
+	}
+	if err := state.Error(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 没有预取的存储项仍然从底层存储读取
+	if got := state.GetState(contract, hash.Hash{3}); got != (hash.Hash{3}) {
+		t.Errorf("GetState: got %x", got)
+	}
+	if store.reads.Load() == 0 {
+		t.Errorf("Expected slot that was not prefetched to be read from the database")
+	}
+}
+
+func TestPrefetcherClose(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	state.AddBalance(types.Address{1}, 1)
+	root := mustCommit(t, state)
+
+	store := &countingStore{KVStore: db}
+	p := NewPrefetcher(store, root, 2)
+	for i := 0; i < 1000; i++ {
+		p.Prefetch(types.Address{byte(i), byte(i >> 8)})
+	}
+	p.Close()
+	p.Close()
+	p.Wait()
+
+	// 关闭后提交的任务被丢弃
+	store.reads.Store(0)
+	p.Prefetch(types.Address{1})
+	p.Wait()
+	if n := store.reads.Load(); n != 0 {
+		t.Errorf("Expected task scheduled after Close to be dropped, got %d reads", n)
+	}
+}
@@ -0,0 +1,193 @@
+package snapshot
+
+import (
+	"sync"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// diffLayer 是一次状态提交相对于父层的修改，保存在内存中
+type diffLayer struct {
+	root hash.Hash
+
+	lock   sync.RWMutex
+	parent layer // 合并到磁盘后会被替换为新的磁盘层
+	stale  bool
+
+	destructs   map[types.Address]struct{}             // 存储被整体清除的账户
+	accountData map[types.Address][]byte               // 账户的 RLP 编码，nil 表示删除
+	storageData map[types.Address]map[hash.Hash][]byte // 存储值，nil 表示删除
+}
+
+func newDiffLayer(parent layer, root hash.Hash, destructs map[types.Address]struct{}, accounts map[types.Address][]byte, storage map[types.Address]map[hash.Hash][]byte) *diffLayer {
+	dl := &diffLayer{
+		root:        root,
+		parent:      parent,
+		destructs:   destructs,
+		accountData: accounts,
+		storageData: storage,
+	}
+	if dl.destructs == nil {
+		dl.destructs = make(map[types.Address]struct{})
+	}
+	if dl.accountData == nil {
+		dl.accountData = make(map[types.Address][]byte)
+	}
+	if dl.storageData == nil {
+		dl.storageData = make(map[types.Address]map[hash.Hash][]byte)
+	}
+	return dl
+}
+
+func (dl *diffLayer) Root() hash.Hash {
+	return dl.root
+}
+
+// parentLayer 返回父层
+func (dl *diffLayer) parentLayer() layer {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.parent
+}
+
+// setParent 在父层合并到磁盘后替换父层
+func (dl *diffLayer) setParent(parent layer) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.parent = parent
+}
+
+// basedOn 判断 disk 是否在该层的祖先链上
+func (dl *diffLayer) basedOn(disk *diskLayer) bool {
+	for l := layer(dl); ; {
+		d, ok := l.(*diffLayer)
+		if !ok {
+			return l == disk
+		}
+		if d.isStale() {
+			return false
+		}
+		l = d.parentLayer()
+	}
+}
+
+func (dl *diffLayer) isStale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+func (dl *diffLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+func (dl *diffLayer) Account(addr types.Address) (*types.Account, error) {
+	data, err := dl.accountRLP(addr)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAccount(data)
+}
+
+func (dl *diffLayer) accountRLP(addr types.Address) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, ErrSnapshotStale
+	}
+	if data, ok := dl.accountData[addr]; ok {
+		dl.lock.RUnlock()
+		return data, nil
+	}
+	if _, ok := dl.destructs[addr]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.accountRLP(addr)
+}
+
+func (dl *diffLayer) Storage(addr types.Address, key hash.Hash) (hash.Hash, error) {
+	data, err := dl.storage(addr, key)
+	return hash.BytesToHash(data), err
+}
+
+func (dl *diffLayer) storage(addr types.Address, key hash.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, ErrSnapshotStale
+	}
+	if slots, ok := dl.storageData[addr]; ok {
+		if data, ok := slots[key]; ok {
+			dl.lock.RUnlock()
+			return data, nil
+		}
+	}
+	if _, ok := dl.destructs[addr]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.storage(addr, key)
+}
+
+// merge 把较新的差异层 newer 合并到 dl 中
+func (dl *diffLayer) merge(newer *diffLayer) {
+	for addr := range newer.destructs {
+		dl.destructs[addr] = struct{}{}
+		delete(dl.storageData, addr)
+	}
+	for addr, data := range newer.accountData {
+		dl.accountData[addr] = data
+	}
+	for addr, slots := range newer.storageData {
+		merged, ok := dl.storageData[addr]
+		if !ok {
+			merged = make(map[hash.Hash][]byte)
+			dl.storageData[addr] = merged
+		}
+		for key, value := range slots {
+			merged[key] = value
+		}
+	}
+}
+
+// writeTo 把差异层的修改写入批次，先清除被销毁账户的存储再写入新值
+func (dl *diffLayer) writeTo(db kvstore.KVStore, batch kvstore.Batch) error {
+	for addr := range dl.destructs {
+		if err := rawdb.DeleteAccountStorageSnapshot(db, batch, addr); err != nil {
+			return err
+		}
+	}
+	for addr, data := range dl.accountData {
+		if data == nil {
+			rawdb.DeleteAccountSnapshot(batch, addr)
+		} else {
+			rawdb.WriteAccountSnapshot(batch, addr, data)
+		}
+	}
+	for addr, slots := range dl.storageData {
+		for key, value := range slots {
+			if value == nil {
+				rawdb.DeleteStorageSnapshot(batch, addr, key)
+			} else {
+				rawdb.WriteStorageSnapshot(batch, addr, key, value)
+			}
+		}
+	}
+	return nil
+}
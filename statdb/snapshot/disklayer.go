@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"errors"
+	"sync"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// diskLayer 是保存在数据库中的扁平快照
+type diskLayer struct {
+	db   kvstore.KVStore
+	root hash.Hash
+
+	lock  sync.RWMutex
+	stale bool
+
+	genDone chan struct{} // 生成完成后关闭
+	genErr  error         // 生成过程中的错误，genDone 关闭后才可读取
+}
+
+// newDiskLayer 返回一个已经生成完成的磁盘层
+func newDiskLayer(db kvstore.KVStore, root hash.Hash) *diskLayer {
+	done := make(chan struct{})
+	close(done)
+	return &diskLayer{db: db, root: root, genDone: done}
+}
+
+func (dl *diskLayer) Root() hash.Hash {
+	return dl.root
+}
+
+// generating 返回磁盘快照是否还在生成中
+func (dl *diskLayer) generating() bool {
+	select {
+	case <-dl.genDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// check 检查磁盘层当前是否可以读取，调用方需持有读锁。
+// 检查和之后的数据库读取要在同一次持锁内完成，否则可能读到合并进来的新数据
+func (dl *diskLayer) check() error {
+	if dl.stale {
+		return ErrSnapshotStale
+	}
+	if dl.generating() {
+		return ErrNotCoveredYet
+	}
+	if dl.genErr != nil {
+		return ErrNotCoveredYet
+	}
+	return nil
+}
+
+func (dl *diskLayer) Account(addr types.Address) (*types.Account, error) {
+	data, err := dl.accountRLP(addr)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAccount(data)
+}
+
+func (dl *diskLayer) accountRLP(addr types.Address) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if err := dl.check(); err != nil {
+		return nil, err
+	}
+	data, err := rawdb.ReadAccountSnapshot(dl.db, addr)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (dl *diskLayer) Storage(addr types.Address, key hash.Hash) (hash.Hash, error) {
+	data, err := dl.storage(addr, key)
+	return hash.BytesToHash(data), err
+}
+
+func (dl *diskLayer) storage(addr types.Address, key hash.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if err := dl.check(); err != nil {
+		return nil, err
+	}
+	data, err := rawdb.ReadStorageSnapshot(dl.db, addr, key)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// replace 在写锁内执行 write 把新数据写入数据库，成功后把磁盘层标记为失效。
+// 写入期间读取会等待，写入完成后读取会返回 ErrSnapshotStale
+func (dl *diskLayer) replace(write func() error) error {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if err := write(); err != nil {
+		return err
+	}
+	dl.stale = true
+	return nil
+}
+
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
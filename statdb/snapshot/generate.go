@@ -0,0 +1,80 @@
+package snapshot
+
+import (
+	"hyblockchain/kvstore"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// genBatchSize 是生成快照时每个批次的最大写入条数
+const genBatchSize = 1024
+
+// generateSnapshot 删除旧的磁盘快照，并在后台从根为 root 的状态树重新生成
+func generateSnapshot(db kvstore.KVStore, root hash.Hash) *diskLayer {
+	dl := &diskLayer{db: db, root: root, genDone: make(chan struct{})}
+	go func() {
+		dl.genErr = generate(db, root)
+		close(dl.genDone)
+	}()
+	return dl
+}
+
+// generate 遍历账户树和每个账户的存储树，写入扁平快照，最后写入快照根
+func generate(db kvstore.KVStore, root hash.Hash) error {
+	if err := rawdb.DeleteSnapshotRoot(db); err != nil {
+		return err
+	}
+	batch := db.Batch()
+	if err := rawdb.DeleteSnapshot(db, batch); err != nil {
+		return err
+	}
+	if err := db.Write(batch); err != nil {
+		return err
+	}
+
+	flush := func() error {
+		if batch.Len() < genBatchSize {
+			return nil
+		}
+		if err := db.Write(batch); err != nil {
+			return err
+		}
+		batch = db.Batch()
+		return nil
+	}
+
+	trie, err := openTrie(db, root)
+	if err != nil {
+		return err
+	}
+	err = trie.Iterate(func(key, value []byte) error {
+		var addr types.Address
+		copy(addr[:], key)
+		rawdb.WriteAccountSnapshot(batch, addr, value)
+
+		account, err := decodeAccount(value)
+		if err != nil {
+			return err
+		}
+		if account.Root != (hash.Hash{}) {
+			storage, err := openTrie(db, account.Root)
+			if err != nil {
+				return err
+			}
+			err = storage.Iterate(func(key, value []byte) error {
+				rawdb.WriteStorageSnapshot(batch, addr, hash.BytesToHash(key), value)
+				return flush()
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	rawdb.WriteSnapshotRoot(batch, root)
+	return db.Write(batch)
+}
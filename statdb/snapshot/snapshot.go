@@ -0,0 +1,226 @@
+package snapshot
+
+import (
+	"errors"
+	"sync"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+var (
+	// ErrSnapshotStale 表示快照层已经被合并到磁盘，不能再读取
+	ErrSnapshotStale = errors.New("snapshot: layer is stale")
+	// ErrNotCoveredYet 表示磁盘快照还在生成中
+	ErrNotCoveredYet = errors.New("snapshot: not covered yet")
+	// ErrSnapshotMissing 表示找不到对应状态根的快照
+	ErrSnapshotMissing = errors.New("snapshot: unknown state root")
+)
+
+// Snapshot 是某个状态根下全部账户和存储的扁平视图，读取只需要一次查找
+type Snapshot interface {
+	// Root 返回快照对应的状态根
+	Root() hash.Hash
+	// Account 返回账户信息，账户不存在时返回 nil
+	Account(addr types.Address) (*types.Account, error)
+	// Storage 返回账户存储中 key 对应的值，不存在时返回零值
+	Storage(addr types.Address, key hash.Hash) (hash.Hash, error)
+}
+
+// layer 是快照树中的一层，最底层是 diskLayer，上面叠加若干 diffLayer
+type layer interface {
+	Snapshot
+
+	accountRLP(addr types.Address) ([]byte, error)
+	storage(addr types.Address, key hash.Hash) ([]byte, error)
+	markStale()
+}
+
+// Tree 管理磁盘快照和叠加在上面的内存差异层。每次提交状态都会增加一个
+// 差异层，Cap 把过深的差异层合并到磁盘
+type Tree struct {
+	db     kvstore.KVStore
+	lock   sync.RWMutex
+	layers map[hash.Hash]layer
+}
+
+// New 打开根为 root 的快照树。磁盘快照和 root 不一致时从状态树重新生成，
+// async 为 true 时在后台生成，生成完成前读取会返回 ErrNotCoveredYet
+func New(db kvstore.KVStore, root hash.Hash, async bool) (*Tree, error) {
+	root, err := normalizeRoot(db, root)
+	if err != nil {
+		return nil, err
+	}
+	var disk *diskLayer
+	if diskRoot, err := rawdb.ReadSnapshotRoot(db); err == nil && diskRoot == root {
+		disk = newDiskLayer(db, root)
+	} else {
+		disk = generateSnapshot(db, root)
+	}
+	tree := &Tree{
+		db:     db,
+		layers: map[hash.Hash]layer{root: disk},
+	}
+	if !async {
+		if err := tree.Wait(); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// normalizeRoot 把零值根转换为空状态树的根哈希，并检查根是否存在
+func normalizeRoot(db kvstore.KVStore, root hash.Hash) (hash.Hash, error) {
+	trie, err := openTrie(db, root)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	return hash.BytesToHash(trie.RootHash()), nil
+}
+
+// openTrie 打开根为 root 的 MPT，零值根表示空树
+func openTrie(db kvstore.KVStore, root hash.Hash) (*mpt.MPT, error) {
+	if root == (hash.Hash{}) {
+		return mpt.NewMPT(db), nil
+	}
+	return mpt.NewMPTWithRoot(db, root[:])
+}
+
+// Wait 等待磁盘快照生成完成，返回生成过程中的错误
+func (t *Tree) Wait() error {
+	t.lock.RLock()
+	disk := t.disk()
+	t.lock.RUnlock()
+
+	<-disk.genDone
+	return disk.genErr
+}
+
+// disk 返回当前的磁盘层，调用方需持有锁
+func (t *Tree) disk() *diskLayer {
+	for _, l := range t.layers {
+		if disk, ok := l.(*diskLayer); ok {
+			return disk
+		}
+	}
+	return nil
+}
+
+// Snapshot 返回状态根为 root 的快照，不存在时返回 nil
+func (t *Tree) Snapshot(root hash.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if l, ok := t.layers[root]; ok {
+		return l
+	}
+	return nil
+}
+
+// Update 在 parent 之上增加一个状态根为 root 的差异层。
+// destructs 是存储被整体清除的账户，accounts 中值为 nil 表示账户被删除，
+// storage 中值为 nil 表示存储项被删除
+func (t *Tree) Update(root, parent hash.Hash, destructs map[types.Address]struct{}, accounts map[types.Address][]byte, storage map[types.Address]map[hash.Hash][]byte) error {
+	if root == parent {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	parentLayer, ok := t.layers[parent]
+	if !ok {
+		return ErrSnapshotMissing
+	}
+	t.layers[root] = newDiffLayer(parentLayer, root, destructs, accounts, storage)
+	return nil
+}
+
+// Cap 保留 root 之上最多 layers 个差异层，更深的差异层合并后写入磁盘。
+// 磁盘快照还在生成时不做任何事
+func (t *Tree) Cap(root hash.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	l, ok := t.layers[root]
+	if !ok {
+		return ErrSnapshotMissing
+	}
+	diff, ok := l.(*diffLayer)
+	if !ok {
+		return nil
+	}
+
+	// chain[0] 是 root 对应的层，越往后越旧
+	var chain []*diffLayer
+	var disk *diskLayer
+	for {
+		chain = append(chain, diff)
+		parent := diff.parentLayer()
+		if d, ok := parent.(*diffLayer); ok {
+			diff = d
+			continue
+		}
+		disk = parent.(*diskLayer)
+		break
+	}
+	if len(chain) <= layers || disk.generating() {
+		return nil
+	}
+
+	// 从旧到新合并需要写入磁盘的差异层
+	flatten := chain[layers:]
+	merged := newDiffLayer(nil, flatten[0].root, nil, nil, nil)
+	for i := len(flatten) - 1; i >= 0; i-- {
+		merged.merge(flatten[i])
+	}
+	batch := t.db.Batch()
+	if err := merged.writeTo(t.db, batch); err != nil {
+		return err
+	}
+	rawdb.WriteSnapshotRoot(batch, merged.root)
+	err := disk.replace(func() error {
+		return t.db.Write(batch)
+	})
+	if err != nil {
+		return err
+	}
+
+	newDisk := newDiskLayer(t.db, merged.root)
+	for _, d := range flatten {
+		d.markStale()
+	}
+	if layers > 0 {
+		chain[layers-1].setParent(newDisk)
+	}
+
+	// 只保留仍然建立在新磁盘层之上的层，其余分叉随之失效
+	kept := map[hash.Hash]layer{newDisk.root: newDisk}
+	for r, l := range t.layers {
+		if d, ok := l.(*diffLayer); ok && d.basedOn(newDisk) {
+			kept[r] = l
+		} else if l != newDisk {
+			l.markStale()
+		}
+	}
+	t.layers = kept
+	return nil
+}
+
+// decodeAccount 解码账户的 RLP 编码，data 为 nil 表示账户不存在
+func decodeAccount(data []byte) (*types.Account, error) {
+	if data == nil {
+		return nil, nil
+	}
+	account := new(types.Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
@@ -0,0 +1,197 @@
+package snapshot
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+func encodeAccount(t *testing.T, account *types.Account) []byte {
+	t.Helper()
+	data, err := rlp.EncodeToBytes(account)
+	if err != nil {
+		t.Fatalf("failed to encode account: %v", err)
+	}
+	return data
+}
+
+func TestSnapshotTree(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	addr1, addr2 := types.Address{1}, types.Address{2}
+	slot := hash.Hash{7}
+
+	// 构造一个带存储的状态树
+	storage := mpt.NewMPT(db)
+	if err := storage.Put(slot[:], hash.Hash{0xaa}.Bytes()); err != nil {
+		t.Fatalf("Put storage failed: %v", err)
+	}
+	accounts := mpt.NewMPT(db)
+	accounts.Put(addr1[:], encodeAccount(t, &types.Account{Amount: 100, Root: hash.BytesToHash(storage.RootHash())}))
+	accounts.Put(addr2[:], encodeAccount(t, &types.Account{Amount: 200}))
+	root := hash.BytesToHash(accounts.RootHash())
+
+	tree, err := New(db, root, true)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := tree.Wait(); err != nil {
+		t.Fatalf("Generation failed: %v", err)
+	}
+	snap := tree.Snapshot(root)
+	if acc, err := snap.Account(addr1); err != nil || acc.Amount != 100 {
+		t.Fatalf("Account from disk layer: got %+v, %v", acc, err)
+	}
+	if value, err := snap.Storage(addr1, slot); err != nil || value != (hash.Hash{0xaa}) {
+		t.Fatalf("Storage from disk layer: got %x, %v", value, err)
+	}
+	if acc, err := snap.Account(types.Address{3}); err != nil || acc != nil {
+		t.Fatalf("Expected missing account, got %+v, %v", acc, err)
+	}
+
+	// 第一个差异层：销毁 addr1 后重新创建，删除 addr2
+	root2 := hash.Hash{2}
+	err = tree.Update(root2, root,
+		map[types.Address]struct{}{addr1: {}},
+		map[types.Address][]byte{addr1: encodeAccount(t, &types.Account{Amount: 1}), addr2: nil},
+		nil)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// 第二个差异层：写入新的存储
+	root3 := hash.Hash{3}
+	err = tree.Update(root3, root2, nil,
+		map[types.Address][]byte{addr1: encodeAccount(t, &types.Account{Amount: 2})},
+		map[types.Address]map[hash.Hash][]byte{addr1: {{8}: hash.Hash{0xbb}.Bytes()}})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := tree.Update(hash.Hash{4}, hash.Hash{9}, nil, nil, nil); !errors.Is(err, ErrSnapshotMissing) {
+		t.Fatalf("Expected ErrSnapshotMissing, got %v", err)
+	}
+
+	check := func(snap Snapshot) {
+		t.Helper()
+		if acc, err := snap.Account(addr1); err != nil || acc.Amount != 2 {
+			t.Errorf("Account addr1: got %+v, %v", acc, err)
+		}
+		if acc, err := snap.Account(addr2); err != nil || acc != nil {
+			t.Errorf("Expected addr2 to be deleted, got %+v, %v", acc, err)
+		}
+		if value, err := snap.Storage(addr1, slot); err != nil || value != (hash.Hash{}) {
+			t.Errorf("Expected destructed storage to be empty, got %x, %v", value, err)
+		}
+		if value, err := snap.Storage(addr1, hash.Hash{8}); err != nil || value != (hash.Hash{0xbb}) {
+			t.Errorf("Storage in diff layer: got %x, %v", value, err)
+		}
+	}
+	check(tree.Snapshot(root3))
+	if acc, _ := tree.Snapshot(root).Account(addr2); acc == nil || acc.Amount != 200 {
+		t.Errorf("Expected base layer to be unchanged, got %+v", acc)
+	}
+
+	// 只保留一个差异层，root2 合并到磁盘
+	old := tree.Snapshot(root)
+	if err := tree.Cap(root3, 1); err != nil {
+		t.Fatalf("Cap failed: %v", err)
+	}
+	if got, err := rawdb.ReadSnapshotRoot(db); err != nil || got != root2 {
+		t.Fatalf("Expected disk root %x, got %x, %v", root2, got, err)
+	}
+	if tree.Snapshot(root) != nil {
+		t.Errorf("Expected flattened layer to be removed")
+	}
+	if _, err := old.Account(addr1); !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("Expected ErrSnapshotStale, got %v", err)
+	}
+	check(tree.Snapshot(root3))
+
+	// 全部合并到磁盘后重新打开，不需要重新生成
+	if err := tree.Cap(root3, 0); err != nil {
+		t.Fatalf("Cap failed: %v", err)
+	}
+	if _, err := rawdb.ReadSnapshotRoot(db); err != nil {
+		t.Fatalf("ReadSnapshotRoot failed: %v", err)
+	}
+	reopened := &Tree{db: db, layers: map[hash.Hash]layer{root3: newDiskLayer(db, root3)}}
+	check(reopened.Snapshot(root3))
+}
+
+// pausingStore 在读取账户快照时暂停，直到 release 被关闭
+type pausingStore struct {
+	kvstore.KVStore
+	armed   atomic.Bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *pausingStore) Get(key []byte) ([]byte, error) {
+	if len(key) == 1+20 && key[0] == 'a' && p.armed.CompareAndSwap(true, false) {
+		close(p.entered)
+		<-p.release
+	}
+	return p.KVStore.Get(key)
+}
+
+func TestSnapshotCapDuringRead(t *testing.T) {
+	db := &pausingStore{
+		KVStore: memorydb.NewMemoryDB(),
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	addr := types.Address{1}
+	accounts := mpt.NewMPT(db)
+	accounts.Put(addr[:], encodeAccount(t, &types.Account{Amount: 1}))
+	root := hash.BytesToHash(accounts.RootHash())
+	tree, err := New(db, root, false)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	base := tree.Snapshot(root)
+	root2 := hash.Hash{2}
+	err = tree.Update(root2, root, nil, map[types.Address][]byte{addr: encodeAccount(t, &types.Account{Amount: 2})}, nil)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// 读取已经通过检查、还没有读数据库时合并差异层，读取不能得到合并进来的新数据
+	db.armed.Store(true)
+	type result struct {
+		acc *types.Account
+		err error
+	}
+	read := make(chan result)
+	go func() {
+		acc, err := base.Account(addr)
+		read <- result{acc, err}
+	}()
+	<-db.entered
+	capped := make(chan error)
+	go func() { capped <- tree.Cap(root2, 0) }()
+	var capErr error
+	select {
+	case capErr = <-capped:
+		t.Errorf("Cap finished while the old disk layer was being read")
+		close(db.release)
+	case <-time.After(50 * time.Millisecond):
+		close(db.release)
+		capErr = <-capped
+	}
+	if capErr != nil {
+		t.Fatalf("Cap failed: %v", capErr)
+	}
+	if res := <-read; res.err == nil && res.acc.Amount != 1 {
+		t.Errorf("Old disk layer returned flattened account %+v", res.acc)
+	}
+	if _, err := base.Account(addr); !errors.Is(err, ErrSnapshotStale) {
+		t.Errorf("Expected ErrSnapshotStale after Cap, got %v", err)
+	}
+}
@@ -1,13 +1,27 @@
 package statdb
 
 import (
-	"hash"
+	"errors"
 	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+var (
+	ErrInsufficientBalance = errors.New("statdb: insufficient balance")
+	ErrBalanceOverflow     = errors.New("statdb: balance overflow")
+	ErrNonceOverflow       = errors.New("statdb: nonce overflow")
 )
 
 type StatDB interface {
 	SetStatRoot(root hash.Hash)
 	Load(addr types.Address) *types.Account
 	Store(addr types.Address, account *types.Account)
+	DeleteAccount(addr types.Address) bool
 	SetRoot(root hash.Hash)
+
+	AddBalance(addr types.Address, amount uint64) error
+	SubBalance(addr types.Address, amount uint64) error
+	Transfer(from, to types.Address, amount uint64) error
+	SetNonce(addr types.Address, nonce uint64)
+	IncNonce(addr types.Address) error
 }
@@ -0,0 +1,175 @@
+package statdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"hyblockchain/kvstore"
+	"hyblockchain/mpt"
+	"hyblockchain/rawdb"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+// stateObject 是 StateDB 中缓存的一个账户，修改先作用在这里，
+// 计算根哈希时才写回状态树
+type stateObject struct {
+	address types.Address
+	data    types.Account
+	deleted bool // 账户已被删除，计算根哈希时从状态树中移除
+	created bool // 账户在上次计算根哈希之后被创建
+
+	// 存储树，从状态中加载的账户第一次访问时打开。新建、重新创建或存储被替换的账户
+	// 一开始就持有新的存储树，存储树打开后只从它读取，快照中的旧存储不再使用
+	trie          *mpt.MPT
+	originStorage map[hash.Hash]hash.Hash // 已读取的存储树中的值
+	dirtyStorage  map[hash.Hash]hash.Hash // 尚未写回存储树的修改
+
+	code      []byte // 合约代码，第一次访问时加载
+	dirtyCode bool   // 代码被修改过，计算根哈希时需要写入数据库
+}
+
+func newObject(address types.Address, data types.Account) *stateObject {
+	return &stateObject{
+		address:       address,
+		data:          data,
+		originStorage: make(map[hash.Hash]hash.Hash),
+		dirtyStorage:  make(map[hash.Hash]hash.Hash),
+	}
+}
+
+// account 返回账户数据的副本
+func (o *stateObject) account() *types.Account {
+	data := o.data
+	return &data
+}
+
+// empty 判断账户是否为空：余额、nonce 为零，没有代码和存储
+func (o *stateObject) empty() bool {
+	return o.data == types.Account{}
+}
+
+// getTrie 返回账户的存储树，Account.Root 为零值时是一棵空树
+func (o *stateObject) getTrie(s *StateDB) (*mpt.MPT, error) {
+	if o.trie == nil {
+		trie, err := openTrie(s.db, o.data.Root)
+		if err != nil {
+			return nil, err
+		}
+		o.trie = trie
+	}
+	return o.trie, nil
+}
+
+// getState 返回存储项的当前值，不存在时返回零值
+func (o *stateObject) getState(s *StateDB, key hash.Hash) hash.Hash {
+	if value, ok := o.dirtyStorage[key]; ok {
+		return value
+	}
+	if value, ok := o.originStorage[key]; ok {
+		return value
+	}
+	if o.trie == nil && s.snap != nil {
+		if value, err := s.snap.Storage(o.address, key); err == nil {
+			o.originStorage[key] = value
+			return value
+		}
+	}
+	var value hash.Hash
+	trie, err := o.getTrie(s)
+	if err != nil {
+		s.setError(err)
+		return value
+	}
+	data, err := trie.Get(key[:])
+	if err != nil && !errors.Is(err, mpt.ErrNotFound) {
+		s.setError(err)
+		return value
+	}
+	copy(value[:], data)
+	o.originStorage[key] = value
+	return value
+}
+
+// resetStorage 丢弃账户的全部存储，之后读取到的存储都是零值
+func (o *stateObject) resetStorage(s *StateDB) {
+	o.trie = mpt.NewMPT(s.db)
+	o.data.Root = hash.Hash{}
+	o.originStorage = make(map[hash.Hash]hash.Hash)
+	o.dirtyStorage = make(map[hash.Hash]hash.Hash)
+}
+
+// updateRoot 把存储的修改写回内存中的存储树，并更新 Account.Root
+func (o *stateObject) updateRoot(s *StateDB) {
+	if len(o.dirtyStorage) == 0 {
+		return
+	}
+	trie, err := o.getTrie(s)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	for key, value := range o.dirtyStorage {
+		// 值为零的存储项从树中删除
+		if value == (hash.Hash{}) {
+			s.setError(trie.Remove(key[:]))
+		} else {
+			s.setError(trie.Update(key[:], value[:]))
+		}
+		o.originStorage[key] = value
+		s.diff.updateStorage(o.address, key, value)
+	}
+	o.dirtyStorage = make(map[hash.Hash]hash.Hash)
+
+	o.data.Root = hash.Hash{}
+	if root := trie.RootHash(); !bytes.Equal(root, trie.EmptyRootHash()) {
+		copy(o.data.Root[:], root)
+	}
+}
+
+// getCode 返回账户的合约代码，没有代码时返回 nil
+func (o *stateObject) getCode(s *StateDB) []byte {
+	if o.code != nil || o.data.CodeHash == (hash.Hash{}) {
+		return o.code
+	}
+	if code, ok := s.codeCache[o.data.CodeHash]; ok {
+		o.code = code
+		return code
+	}
+	code, err := rawdb.ReadCode(s.db, o.data.CodeHash)
+	if err != nil {
+		s.setError(fmt.Errorf("statdb: missing code %x: %w", o.data.CodeHash, err))
+		return nil
+	}
+	s.codeCache[o.data.CodeHash] = code
+	o.code = code
+	return code
+}
+
+// commit 把存储树和修改过的代码写入 batch
+func (o *stateObject) commit(s *StateDB, batch kvstore.Batch) {
+	o.updateCode(s, batch)
+	if o.trie != nil {
+		o.trie.CommitTo(batch)
+	}
+}
+
+// updateCode 把修改过的代码写入 batch，数据库中已经存在的代码不会重复写入
+func (o *stateObject) updateCode(s *StateDB, batch kvstore.Batch) {
+	if !o.dirtyCode {
+		return
+	}
+	o.dirtyCode = false
+	if len(o.code) == 0 {
+		return
+	}
+	has, err := rawdb.HasCode(s.db, o.data.CodeHash)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	if !has {
+		rawdb.WriteCode(batch, o.data.CodeHash, o.code)
+	}
+}
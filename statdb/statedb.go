@@ -0,0 +1,503 @@
+package statdb
+
+import (
+	"errors"
+	"fmt"
+
+	"hyblockchain/crypto/sha3"
+	"hyblockchain/kvstore"
+	"hyblockchain/mpt"
+	"hyblockchain/statdb/snapshot"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/math"
+	"hyblockchain/utils/rlp"
+)
+
+// snapshotLayers 是提交状态时保留在内存中的快照差异层数量
+const snapshotLayers = 128
+
+// revision 是一个快照，记录快照创建时 journal 的长度
+type revision struct {
+	id           int
+	journalIndex int
+}
+
+// StateDB 是基于 MPT 的持久化 StatDB 实现，账户以 RLP 编码存放在
+// 以地址为键的 MPT 中。修改先缓存在内存中并记入 journal，可以通过
+// Snapshot 和 RevertToSnapshot 嵌套回滚，调用 Root 时才写回状态树。
+// StatDB 接口的方法不返回错误，读写中遇到的第一个错误会被记录下来，
+// 通过 Error 获取
+type StateDB struct {
+	db   kvstore.KVStore
+	trie *mpt.MPT
+	err  error
+
+	objects   map[types.Address]*stateObject
+	codeCache map[hash.Hash][]byte // 代码哈希 -> 代码，多个账户共用
+
+	journal        *journal
+	validRevisions []revision
+	nextRevisionID int
+
+	deleteEmptyObjects bool // 计算根哈希时删除被修改过的空账户
+
+	originalRoot hash.Hash  // 上次提交（或打开时）的状态根
+	diff         *stateDiff // 上次提交以来的修改
+	committed    *stateDiff // 上次提交写入的修改
+
+	// 扁平快照，存在时读取优先走快照，提交时增加新的差异层
+	snaps *snapshot.Tree
+	snap  snapshot.Snapshot
+}
+
+// NewStateDB 打开 db 中根为 root 的状态，root 为零值时表示空状态
+func NewStateDB(db kvstore.KVStore, root hash.Hash) (*StateDB, error) {
+	trie, err := openTrie(db, root)
+	if err != nil {
+		return nil, err
+	}
+	return &StateDB{
+		db:           db,
+		trie:         trie,
+		objects:      make(map[types.Address]*stateObject),
+		codeCache:    make(map[hash.Hash][]byte),
+		journal:      newJournal(),
+		originalRoot: hash.BytesToHash(trie.RootHash()),
+		diff:         newStateDiff(),
+		committed:    newStateDiff(),
+	}, nil
+}
+
+// NewStateDBWithSnapshot 和 NewStateDB 相同，但读取账户和存储时优先使用 snaps
+// 中的扁平快照，提交时把修改作为新的差异层加入 snaps
+func NewStateDBWithSnapshot(db kvstore.KVStore, root hash.Hash, snaps *snapshot.Tree) (*StateDB, error) {
+	s, err := NewStateDB(db, root)
+	if err != nil {
+		return nil, err
+	}
+	s.snaps = snaps
+	s.resetSnapshot()
+	return s, nil
+}
+
+// resetSnapshot 切换到 originalRoot 对应的快照
+func (s *StateDB) resetSnapshot() {
+	if s.snaps != nil {
+		s.snap = s.snaps.Snapshot(s.originalRoot)
+	}
+}
+
+// openTrie 打开根为 root 的状态树
+func openTrie(db kvstore.KVStore, root hash.Hash) (*mpt.MPT, error) {
+	if root == (hash.Hash{}) {
+		return mpt.NewMPT(db), nil
+	}
+	return mpt.NewMPTWithRoot(db, root[:])
+}
+
+// readAccount 从状态树读取账户，账户不存在时返回 nil
+func readAccount(trie *mpt.MPT, addr types.Address) (*types.Account, error) {
+	data, err := trie.Get(addr[:])
+	if errors.Is(err, mpt.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	account := new(types.Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// getObject 返回地址对应的账户，账户不存在或已删除时返回 nil
+func (s *StateDB) getObject(addr types.Address) *stateObject {
+	if obj, ok := s.objects[addr]; ok {
+		if obj.deleted {
+			return nil
+		}
+		return obj
+	}
+	// 优先从快照读取，快照不可用时退回状态树
+	if s.snap != nil {
+		if account, err := s.snap.Account(addr); err == nil {
+			if account == nil {
+				return nil
+			}
+			obj := newObject(addr, *account)
+			s.objects[addr] = obj
+			return obj
+		}
+	}
+	data, err := s.trie.Get(addr[:])
+	if errors.Is(err, mpt.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		s.setError(err)
+		return nil
+	}
+	var account types.Account
+	if err := rlp.DecodeBytes(data, &account); err != nil {
+		s.setError(err)
+		return nil
+	}
+	obj := newObject(addr, account)
+	s.objects[addr] = obj
+	return obj
+}
+
+// getOrNewObject 返回地址对应的账户，不存在时创建一个空账户
+func (s *StateDB) getOrNewObject(addr types.Address) *stateObject {
+	if obj := s.getObject(addr); obj != nil {
+		return obj
+	}
+	s.journal.append(createObjectChange{account: addr, prev: s.objects[addr]})
+	obj := newObject(addr, types.Account{})
+	obj.created = true
+	obj.trie = mpt.NewMPT(s.db)
+	s.objects[addr] = obj
+	return obj
+}
+
+// Load 返回指定地址的账户信息，找不到时返回空账户(Nonce=0)
+func (s *StateDB) Load(addr types.Address) *types.Account {
+	obj := s.getObject(addr)
+	if obj == nil {
+		return &types.Account{}
+	}
+	return obj.account()
+}
+
+// Store 设置指定地址的账户信息，account 为 nil 时等同于 DeleteAccount。
+// 已有账户的 Root 和 CodeHash 由状态层维护，account 中的这两个字段只在创建账户时使用
+func (s *StateDB) Store(addr types.Address, account *types.Account) {
+	if account == nil {
+		s.DeleteAccount(addr)
+		return
+	}
+	obj := s.getObject(addr)
+	if obj == nil {
+		s.journal.append(createObjectChange{account: addr, prev: s.objects[addr]})
+		obj = newObject(addr, *account)
+		obj.created = true
+		// 指定了存储树根时从该树读取存储
+		trie, err := openTrie(s.db, account.Root)
+		s.setError(err)
+		obj.trie = trie
+		s.objects[addr] = obj
+		return
+	}
+	s.journal.append(accountChange{account: addr, prev: obj.data})
+	root, codeHash := obj.data.Root, obj.data.CodeHash
+	obj.data = *account
+	obj.data.Root, obj.data.CodeHash = root, codeHash
+}
+
+// DeleteAccount 删除账户，余额、nonce、代码和存储一并清除，返回账户原来是否存在。
+// 之后再访问该地址得到的是一个全新的空账户，不会看到旧的存储。
+// 旧存储树的节点仍留在数据库中，旧的状态根依然可以读取
+func (s *StateDB) DeleteAccount(addr types.Address) bool {
+	obj := s.getObject(addr)
+	if obj == nil {
+		return false
+	}
+	s.journal.append(accountChange{account: addr, prev: obj.data})
+	obj.deleted = true
+	return true
+}
+
+// SetDeleteEmptyObjects 设置是否在计算根哈希时删除被修改过的空账户。
+// 空账户指余额、nonce 为零且没有代码和存储的账户，开启后零金额转账等
+// 操作留下的空账户不会写入状态树；没有被修改过的空账户不受影响
+func (s *StateDB) SetDeleteEmptyObjects(enabled bool) {
+	s.deleteEmptyObjects = enabled
+}
+
+// AddBalance 增加账户余额，账户不存在时会被创建，溢出时返回 ErrBalanceOverflow
+func (s *StateDB) AddBalance(addr types.Address, amount uint64) error {
+	obj := s.getOrNewObject(addr)
+	balance, overflow := math.SafeAdd(obj.data.Amount, amount)
+	if overflow {
+		return fmt.Errorf("%w: address %x", ErrBalanceOverflow, addr)
+	}
+	s.setBalance(obj, balance)
+	return nil
+}
+
+// SubBalance 扣减账户余额，余额不足时返回 ErrInsufficientBalance
+func (s *StateDB) SubBalance(addr types.Address, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+	obj := s.getObject(addr)
+	var have uint64
+	if obj != nil {
+		have = obj.data.Amount
+	}
+	balance, underflow := math.SafeSub(have, amount)
+	if underflow {
+		return fmt.Errorf("%w: address %x has %d, need %d", ErrInsufficientBalance, addr, have, amount)
+	}
+	s.setBalance(obj, balance)
+	return nil
+}
+
+// Transfer 从 from 向 to 转账，失败时两个账户都不会被修改
+func (s *StateDB) Transfer(from, to types.Address, amount uint64) error {
+	if have := s.Load(from).Amount; have < amount {
+		return fmt.Errorf("%w: address %x has %d, need %d", ErrInsufficientBalance, from, have, amount)
+	}
+	if from == to {
+		return nil
+	}
+	if _, overflow := math.SafeAdd(s.Load(to).Amount, amount); overflow {
+		return fmt.Errorf("%w: address %x", ErrBalanceOverflow, to)
+	}
+	if err := s.SubBalance(from, amount); err != nil {
+		return err
+	}
+	return s.AddBalance(to, amount)
+}
+
+// setBalance 修改账户余额并记入 journal
+func (s *StateDB) setBalance(obj *stateObject, balance uint64) {
+	s.journal.append(balanceChange{account: obj.address, prev: obj.data.Amount})
+	obj.data.Amount = balance
+}
+
+// SetNonce 设置账户的 nonce，账户不存在时会被创建
+func (s *StateDB) SetNonce(addr types.Address, nonce uint64) {
+	obj := s.getOrNewObject(addr)
+	s.journal.append(nonceChange{account: addr, prev: obj.data.Nonce})
+	obj.data.Nonce = nonce
+}
+
+// IncNonce 把账户的 nonce 加一，溢出时返回 ErrNonceOverflow
+func (s *StateDB) IncNonce(addr types.Address) error {
+	obj := s.getOrNewObject(addr)
+	nonce, overflow := math.SafeAdd(obj.data.Nonce, 1)
+	if overflow {
+		return fmt.Errorf("%w: address %x", ErrNonceOverflow, addr)
+	}
+	s.journal.append(nonceChange{account: addr, prev: obj.data.Nonce})
+	obj.data.Nonce = nonce
+	return nil
+}
+
+// GetCode 返回账户的合约代码，没有代码时返回 nil
+func (s *StateDB) GetCode(addr types.Address) []byte {
+	obj := s.getObject(addr)
+	if obj == nil {
+		return nil
+	}
+	return obj.getCode(s)
+}
+
+// GetCodeSize 返回账户合约代码的长度
+func (s *StateDB) GetCodeSize(addr types.Address) int {
+	return len(s.GetCode(addr))
+}
+
+// GetCodeHash 返回账户合约代码的 Keccak 哈希，没有代码时返回零值
+func (s *StateDB) GetCodeHash(addr types.Address) hash.Hash {
+	obj := s.getObject(addr)
+	if obj == nil {
+		return hash.Hash{}
+	}
+	return obj.data.CodeHash
+}
+
+// SetCode 设置账户的合约代码，账户不存在时会被创建。
+// 代码以 Keccak 哈希为键保存，相同的代码只保存一份
+func (s *StateDB) SetCode(addr types.Address, code []byte) {
+	obj := s.getOrNewObject(addr)
+	s.journal.append(codeChange{account: addr, prevCode: obj.getCode(s), prevHash: obj.data.CodeHash})
+
+	obj.code, obj.data.CodeHash = nil, hash.Hash{}
+	if len(code) > 0 {
+		obj.code = append([]byte{}, code...)
+		obj.data.CodeHash = sha3.Keccak256(code)
+		s.codeCache[obj.data.CodeHash] = obj.code
+	}
+	obj.dirtyCode = true
+}
+
+// GetState 返回账户存储中 key 对应的值，不存在时返回零值
+func (s *StateDB) GetState(addr types.Address, key hash.Hash) hash.Hash {
+	obj := s.getObject(addr)
+	if obj == nil {
+		return hash.Hash{}
+	}
+	return obj.getState(s, key)
+}
+
+// SetState 设置账户存储中 key 对应的值，账户不存在时会被创建。
+// 设置为零值等于删除该存储项
+func (s *StateDB) SetState(addr types.Address, key, value hash.Hash) {
+	obj := s.getOrNewObject(addr)
+	prev := obj.getState(s, key)
+	if prev == value {
+		return
+	}
+	_, dirty := obj.dirtyStorage[key]
+	s.journal.append(storageChange{account: addr, key: key, prev: prev, prevDirty: dirty})
+	obj.dirtyStorage[key] = value
+}
+
+// Snapshot 创建一个快照，返回的 id 用于 RevertToSnapshot
+func (s *StateDB) Snapshot() int {
+	id := s.nextRevisionID
+	s.nextRevisionID++
+	s.validRevisions = append(s.validRevisions, revision{id, s.journal.length()})
+	return id
+}
+
+// RevertToSnapshot 撤销快照 id 之后的全部修改，该快照之后创建的快照随之失效。
+// id 无效时不做任何修改并记录错误
+func (s *StateDB) RevertToSnapshot(id int) {
+	idx := -1
+	for i := len(s.validRevisions) - 1; i >= 0; i-- {
+		if s.validRevisions[i].id == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		s.setError(fmt.Errorf("statdb: revision id %d cannot be reverted", id))
+		return
+	}
+	s.journal.revert(s, s.validRevisions[idx].journalIndex)
+	s.validRevisions = s.validRevisions[:idx]
+}
+
+// SetRoot 把视图切换到根为 root 的状态，未写回的修改会被丢弃。
+// root 不存在时保持原视图并记录错误
+func (s *StateDB) SetRoot(root hash.Hash) {
+	trie, err := openTrie(s.db, root)
+	if err != nil {
+		s.setError(err)
+		return
+	}
+	s.trie = trie
+	s.objects = make(map[types.Address]*stateObject)
+	s.journal = newJournal()
+	s.validRevisions = s.validRevisions[:0]
+	s.originalRoot = hash.BytesToHash(trie.RootHash())
+	s.diff = newStateDiff()
+	s.resetSnapshot()
+}
+
+// SetStatRoot 是 SetRoot 的别名，兼容接口
+func (s *StateDB) SetStatRoot(root hash.Hash) {
+	s.SetRoot(root)
+}
+
+// IntermediateRoot 把账户和存储的修改写回内存中的状态树并返回根哈希，
+// 不写入数据库。之前的快照全部失效
+func (s *StateDB) IntermediateRoot() hash.Hash {
+	for addr := range s.journal.dirties {
+		obj, ok := s.objects[addr]
+		if !ok {
+			continue
+		}
+		if obj.deleted {
+			s.deleteObject(obj)
+			continue
+		}
+		if obj.created {
+			// 重新创建的账户不继承旧账户的存储
+			s.diff.destruct(addr)
+		}
+		obj.created = false
+		obj.updateRoot(s)
+		if s.deleteEmptyObjects && obj.empty() {
+			obj.deleted = true
+			s.deleteObject(obj)
+			continue
+		}
+		data, err := rlp.EncodeToBytes(&obj.data)
+		if err != nil {
+			s.setError(err)
+			continue
+		}
+		s.setError(s.trie.Update(addr[:], data))
+		s.diff.updateAccount(addr, data)
+	}
+	s.journal = newJournal()
+	s.validRevisions = s.validRevisions[:0]
+
+	return hash.BytesToHash(s.trie.RootHash())
+}
+
+// deleteObject 把账户从状态树中移除，并记录账户的存储被整体清除
+func (s *StateDB) deleteObject(obj *stateObject) {
+	s.setError(s.trie.Remove(obj.address[:]))
+	s.diff.destruct(obj.address)
+	s.diff.updateAccount(obj.address, nil)
+}
+
+// Commit 计算根哈希并把状态树、存储树和合约代码在同一个批次中写入数据库。
+// 之前记录过错误时返回该错误，不写入任何数据
+func (s *StateDB) Commit() (hash.Hash, error) {
+	return s.commit(nil)
+}
+
+// commit 实现 Commit。extra 不为 nil 时在写入前调用，可以把和这次提交
+// 相关的其他数据加入同一个批次，此时 s.committed 已经是这次提交的修改。
+// 写入失败时内存中的状态已经和数据库不一致，错误会被记录下来
+func (s *StateDB) commit(extra func(batch kvstore.Batch) error) (hash.Hash, error) {
+	root := s.IntermediateRoot()
+	if s.err != nil {
+		return hash.Hash{}, s.err
+	}
+	batch := s.db.Batch()
+	for addr, obj := range s.objects {
+		if obj.deleted {
+			delete(s.objects, addr)
+			continue
+		}
+		obj.commit(s, batch)
+	}
+	s.trie.CommitTo(batch)
+	if s.err != nil {
+		return hash.Hash{}, s.err
+	}
+	s.diff.parent, s.diff.root = s.originalRoot, root
+	s.originalRoot = root
+	s.committed, s.diff = s.diff, newStateDiff()
+
+	if extra != nil {
+		if err := extra(batch); err != nil {
+			s.setError(err)
+			return hash.Hash{}, err
+		}
+	}
+	if err := s.db.Write(batch); err != nil {
+		s.setError(err)
+		return hash.Hash{}, err
+	}
+
+	// 快照只是加速读取，更新失败时不影响已经提交的状态，读取会退回状态树
+	if s.snaps != nil {
+		d := s.committed
+		if err := s.snaps.Update(d.root, d.parent, d.destructs, d.accounts, d.storage); err == nil {
+			s.snaps.Cap(root, snapshotLayers)
+		}
+	}
+	s.resetSnapshot()
+	return root, nil
+}
+
+// Error 返回读写过程中记录的第一个错误
+func (s *StateDB) Error() error {
+	return s.err
+}
+
+func (s *StateDB) setError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
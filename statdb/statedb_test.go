@@ -0,0 +1,641 @@
+package statdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"hyblockchain/crypto/sha3"
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/leveldb"
+	"hyblockchain/kvstore/memorydb"
+	"hyblockchain/rawdb"
+	"hyblockchain/statdb/snapshot"
+	"hyblockchain/types"
+	"hyblockchain/utils/hash"
+)
+
+func TestStateDB(t *testing.T) {
+	dbPath := "testdb_statedb"
+	defer os.RemoveAll(dbPath)
+
+	db, err := leveldb.NewLevelDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open leveldb: %v", err)
+	}
+
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr1 := types.Address{1}
+	addr2 := types.Address{2}
+
+	if acc := state.Load(addr1); acc.Nonce != 0 || acc.Amount != 0 {
+		t.Fatalf("Expected empty account, got %+v", acc)
+	}
+	state.Store(addr1, &types.Account{Amount: 100, Nonce: 1})
+	root1 := mustCommit(t, state)
+
+	state.Store(addr2, &types.Account{Amount: 50, Nonce: 2, CodeHash: hash.Hash{9}})
+	state.Store(addr1, &types.Account{Amount: 80, Nonce: 2})
+	root2 := mustCommit(t, state)
+	if err := state.Error(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 切换到旧状态
+	state.SetRoot(root1)
+	if acc := state.Load(addr1); acc.Amount != 100 || acc.Nonce != 1 {
+		t.Errorf("Expected addr1 at root1 to be {100 1}, got %+v", acc)
+	}
+	if acc := state.Load(addr2); acc.Amount != 0 {
+		t.Errorf("Expected addr2 not to exist at root1, got %+v", acc)
+	}
+
+	// 重新打开数据库后读取最新状态
+	db.Close()
+	db, err = leveldb.NewLevelDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to reopen leveldb: %v", err)
+	}
+	defer db.Close()
+
+	state, err = NewStateDB(db, root2)
+	if err != nil {
+		t.Fatalf("NewStateDB at root2 failed: %v", err)
+	}
+	if acc := state.Load(addr2); acc.Amount != 50 || acc.CodeHash != (hash.Hash{9}) {
+		t.Errorf("Expected addr2 to be restored, got %+v", acc)
+	}
+
+	// 删除账户
+	state.Store(addr2, nil)
+	if acc := state.Load(addr2); acc.Amount != 0 {
+		t.Errorf("Expected addr2 to be deleted, got %+v", acc)
+	}
+
+	// 未知的根
+	state.SetRoot(hash.Hash{0xff})
+	if state.Error() == nil {
+		t.Errorf("Expected error for unknown root")
+	}
+	if acc := state.Load(addr1); acc.Amount != 80 {
+		t.Errorf("Expected view to be unchanged after bad SetRoot, got %+v", acc)
+	}
+}
+
+func TestStateDBSnapshot(t *testing.T) {
+	state, err := NewStateDB(memorydb.NewMemoryDB(), hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr1 := types.Address{1}
+	addr2 := types.Address{2}
+
+	state.Store(addr1, &types.Account{Amount: 100})
+	root := state.IntermediateRoot()
+
+	outer := state.Snapshot()
+	state.Store(addr1, &types.Account{Amount: 90, Nonce: 1})
+	state.Store(addr2, &types.Account{Amount: 10})
+
+	// 内层调用失败只回滚自己的修改
+	inner := state.Snapshot()
+	state.Store(addr1, nil)
+	state.Store(addr2, &types.Account{Amount: 20})
+	state.RevertToSnapshot(inner)
+
+	if acc := state.Load(addr1); acc.Amount != 90 || acc.Nonce != 1 {
+		t.Errorf("Expected addr1 to be {90 1} after inner revert, got %+v", acc)
+	}
+	if acc := state.Load(addr2); acc.Amount != 10 {
+		t.Errorf("Expected addr2 to be 10 after inner revert, got %+v", acc)
+	}
+
+	// 回滚外层后内层快照失效
+	state.RevertToSnapshot(outer)
+	if acc := state.Load(addr1); acc.Amount != 100 || acc.Nonce != 0 {
+		t.Errorf("Expected addr1 to be {100 0} after outer revert, got %+v", acc)
+	}
+	if acc := state.Load(addr2); acc.Amount != 0 {
+		t.Errorf("Expected addr2 not to exist after outer revert, got %+v", acc)
+	}
+	if got := state.IntermediateRoot(); got != root {
+		t.Errorf("Expected root %x after revert, got %x", root, got)
+	}
+	if err := state.Error(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	state.RevertToSnapshot(inner)
+	if state.Error() == nil {
+		t.Errorf("Expected error when reverting an invalidated snapshot")
+	}
+}
+
+func TestStateDBStorage(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr := types.Address{1}
+	key1, key2 := hash.Hash{1}, hash.Hash{2}
+
+	state.Store(addr, &types.Account{Amount: 100})
+	state.SetState(addr, key1, hash.Hash{0xaa})
+	state.SetState(addr, key2, hash.Hash{0xbb})
+	if got := state.GetState(addr, key1); got != (hash.Hash{0xaa}) {
+		t.Fatalf("GetState before commit: got %x", got)
+	}
+
+	snap := state.Snapshot()
+	state.SetState(addr, key1, hash.Hash{0xcc})
+	state.RevertToSnapshot(snap)
+	if got := state.GetState(addr, key1); got != (hash.Hash{0xaa}) {
+		t.Errorf("Expected storage to be reverted, got %x", got)
+	}
+
+	root := mustCommit(t, state)
+	storageRoot := state.Load(addr).Root
+	if storageRoot == (hash.Hash{}) {
+		t.Fatalf("Expected Account.Root to be set after Root")
+	}
+
+	// 重新打开后存储仍然可读
+	state, err = NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB at root failed: %v", err)
+	}
+	if got := state.GetState(addr, key2); got != (hash.Hash{0xbb}) {
+		t.Errorf("GetState after reopen: got %x", got)
+	}
+
+	// 撤销后的存储项不再算作修改
+	state.AddBalance(addr, 1)
+	snap = state.Snapshot()
+	state.SetState(addr, key2, hash.Hash{0xdd})
+	state.RevertToSnapshot(snap)
+	if _, ok := state.objects[addr].dirtyStorage[key2]; ok {
+		t.Errorf("Expected reverted slot to be clean")
+	}
+	mustCommit(t, state)
+	diff, err := state.BlockDiff()
+	if err != nil {
+		t.Fatalf("BlockDiff failed: %v", err)
+	}
+	if len(diff.Accounts) != 1 || diff.Accounts[0].Balance == nil || len(diff.Accounts[0].Storage) != 0 {
+		t.Errorf("Expected only the balance change, got %+v", diff.Accounts)
+	}
+	if len(state.committed.storage[addr]) != 0 {
+		t.Errorf("Expected no storage in the state diff, got %v", state.committed.storage[addr])
+	}
+
+	// Store 不会覆盖存储根
+	acc := state.Load(addr)
+	acc.Amount = 50
+	acc.Root = hash.Hash{}
+	state.Store(addr, acc)
+	state.SetState(addr, key2, hash.Hash{})
+	state.SetState(addr, key1, hash.Hash{})
+	state.IntermediateRoot()
+	if got := state.Load(addr); got.Root != (hash.Hash{}) || got.Amount != 50 {
+		t.Errorf("Expected empty storage root after clearing storage, got %+v", got)
+	}
+	if err := state.Error(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestStateDBCode(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr1 := types.Address{1}
+	addr2 := types.Address{2}
+	code := []byte{0x60, 0x60, 0x60, 0x40}
+
+	state.SetCode(addr1, code)
+	state.SetCode(addr2, code)
+	if got := state.GetCodeHash(addr1); got != sha3.Keccak256(code) {
+		t.Fatalf("Unexpected code hash %x", got)
+	}
+	if got := state.GetCodeSize(addr2); got != len(code) {
+		t.Fatalf("Expected code size %d, got %d", len(code), got)
+	}
+
+	snap := state.Snapshot()
+	state.SetCode(addr1, []byte{0x00})
+	state.RevertToSnapshot(snap)
+	if got := state.GetCode(addr1); !bytes.Equal(got, code) {
+		t.Errorf("Expected code to be reverted, got %x", got)
+	}
+
+	root := mustCommit(t, state)
+
+	// 相同的代码只保存一份
+	count := 0
+	iter := db.NewIterator(nil)
+	for iter.Next() {
+		if bytes.Equal(iter.Value(), code) {
+			count++
+		}
+	}
+	iter.Release()
+	if count != 1 {
+		t.Errorf("Expected 1 code entry, got %d", count)
+	}
+
+	state, err = NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB at root failed: %v", err)
+	}
+	if got := state.GetCode(addr2); !bytes.Equal(got, code) {
+		t.Errorf("GetCode after reopen: got %x", got)
+	}
+	if got := state.GetCode(types.Address{3}); got != nil {
+		t.Errorf("Expected no code for missing account, got %x", got)
+	}
+	if err := state.Error(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestStateDBBalance(t *testing.T) {
+	state, err := NewStateDB(memorydb.NewMemoryDB(), hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr1 := types.Address{1}
+	addr2 := types.Address{2}
+
+	if err := state.AddBalance(addr1, 100); err != nil {
+		t.Fatalf("AddBalance failed: %v", err)
+	}
+	if err := state.AddBalance(addr1, ^uint64(0)); !errors.Is(err, ErrBalanceOverflow) {
+		t.Errorf("Expected ErrBalanceOverflow, got %v", err)
+	}
+	if err := state.SubBalance(addr2, 1); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Expected ErrInsufficientBalance, got %v", err)
+	}
+
+	snap := state.Snapshot()
+	if err := state.Transfer(addr1, addr2, 30); err != nil {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+	if err := state.IncNonce(addr1); err != nil {
+		t.Fatalf("IncNonce failed: %v", err)
+	}
+	if a, b := state.Load(addr1), state.Load(addr2); a.Amount != 70 || a.Nonce != 1 || b.Amount != 30 {
+		t.Errorf("Unexpected balances after transfer: %+v %+v", a, b)
+	}
+	state.RevertToSnapshot(snap)
+	if a := state.Load(addr1); a.Amount != 100 || a.Nonce != 0 {
+		t.Errorf("Expected transfer to be reverted, got %+v", a)
+	}
+
+	if err := state.Transfer(addr1, addr2, 101); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Expected ErrInsufficientBalance, got %v", err)
+	}
+	state.AddBalance(addr2, ^uint64(0))
+	if err := state.Transfer(addr1, addr2, 1); !errors.Is(err, ErrBalanceOverflow) {
+		t.Errorf("Expected ErrBalanceOverflow, got %v", err)
+	}
+	if a := state.Load(addr1); a.Amount != 100 {
+		t.Errorf("Expected failed transfer not to change sender, got %+v", a)
+	}
+
+	state.SetNonce(addr1, ^uint64(0))
+	if err := state.IncNonce(addr1); !errors.Is(err, ErrNonceOverflow) {
+		t.Errorf("Expected ErrNonceOverflow, got %v", err)
+	}
+}
+
+func mustCommit(t *testing.T, state *StateDB) hash.Hash {
+	t.Helper()
+	root, err := state.Commit()
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if got := state.IntermediateRoot(); got != root {
+		t.Fatalf("IntermediateRoot %x differs from committed root %x", got, root)
+	}
+	return root
+}
+
+func TestStateDBCommit(t *testing.T) {
+	db := memorydb.NewMemoryDB().(*memorydb.MemoryDB)
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr := types.Address{1}
+	state.AddBalance(addr, 100)
+	state.SetState(addr, hash.Hash{1}, hash.Hash{2})
+	state.SetCode(addr, []byte{0x60})
+
+	// IntermediateRoot 不写数据库
+	before := db.Len()
+	root := state.IntermediateRoot()
+	if after := db.Len(); after != before {
+		t.Fatalf("IntermediateRoot wrote %d entries to the database", after-before)
+	}
+	if _, err := NewStateDB(db, root); err == nil {
+		t.Fatalf("Expected uncommitted root to be missing from the database")
+	}
+
+	if got := mustCommit(t, state); got != root {
+		t.Fatalf("Commit root %x differs from intermediate root %x", got, root)
+	}
+	reopened, err := NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB at committed root failed: %v", err)
+	}
+	if got := reopened.GetState(addr, hash.Hash{1}); got != (hash.Hash{2}) {
+		t.Errorf("GetState after commit: got %x", got)
+	}
+	if got := reopened.GetCode(addr); !bytes.Equal(got, []byte{0x60}) {
+		t.Errorf("GetCode after commit: got %x", got)
+	}
+}
+
+func TestStateDBDeleteAccount(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	addr := types.Address{1}
+	state.AddBalance(addr, 100)
+	state.SetState(addr, hash.Hash{1}, hash.Hash{2})
+	state.SetCode(addr, []byte{0x60})
+	root := mustCommit(t, state)
+
+	if state.DeleteAccount(types.Address{2}) {
+		t.Errorf("Expected DeleteAccount on missing account to return false")
+	}
+
+	// 删除可以被回滚
+	snap := state.Snapshot()
+	if !state.DeleteAccount(addr) {
+		t.Fatalf("Expected DeleteAccount to return true")
+	}
+	state.RevertToSnapshot(snap)
+	if got := state.GetState(addr, hash.Hash{1}); got != (hash.Hash{2}) {
+		t.Fatalf("Expected storage after revert, got %x", got)
+	}
+
+	// 删除后重新创建的账户看不到旧的存储和代码
+	state.DeleteAccount(addr)
+	state.AddBalance(addr, 5)
+	if got := state.GetState(addr, hash.Hash{1}); got != (hash.Hash{}) {
+		t.Errorf("Expected wiped storage, got %x", got)
+	}
+	if code := state.GetCode(addr); code != nil {
+		t.Errorf("Expected wiped code, got %x", code)
+	}
+	mustCommit(t, state)
+	if acc := state.Load(addr); acc.Amount != 5 || acc.Root != (hash.Hash{}) || acc.CodeHash != (hash.Hash{}) {
+		t.Errorf("Unexpected recreated account %+v", acc)
+	}
+
+	// 删除后状态树中没有该账户，旧的状态根仍然可读
+	empty, err := NewStateDB(memorydb.NewMemoryDB(), hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	state.DeleteAccount(addr)
+	if got, want := mustCommit(t, state), empty.IntermediateRoot(); got != want {
+		t.Errorf("Expected empty root %x after deleting the only account, got %x", want, got)
+	}
+	old, err := NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB at old root failed: %v", err)
+	}
+	if got := old.GetState(addr, hash.Hash{1}); got != (hash.Hash{2}) {
+		t.Errorf("Expected storage at old root, got %x", got)
+	}
+}
+
+func TestStateDBDeleteEmptyObjects(t *testing.T) {
+	state, err := NewStateDB(memorydb.NewMemoryDB(), hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	rich, dust, user := types.Address{1}, types.Address{2}, types.Address{3}
+	state.AddBalance(rich, 100)
+	state.AddBalance(dust, 0)
+	state.AddBalance(user, 10)
+	mustCommit(t, state)
+	if acc := state.Load(dust); acc.Amount != 0 {
+		t.Fatalf("Unexpected dust account %+v", acc)
+	}
+
+	state.SetDeleteEmptyObjects(true)
+	// 余额转出后变为空账户，被修改过的空账户在提交时删除
+	state.Transfer(user, rich, 10)
+	state.AddBalance(dust, 0)
+	// 有存储的账户不是空账户
+	state.SetState(types.Address{4}, hash.Hash{1}, hash.Hash{1})
+	mustCommit(t, state)
+
+	want, err := NewStateDB(memorydb.NewMemoryDB(), hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	want.AddBalance(rich, 110)
+	want.SetState(types.Address{4}, hash.Hash{1}, hash.Hash{1})
+	if got, exp := state.IntermediateRoot(), mustCommit(t, want); got != exp {
+		t.Errorf("Expected empty accounts to be removed: root %x, want %x", got, exp)
+	}
+}
+
+func TestStateDBRecreateWithSnapshot(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	snaps, err := snapshot.New(db, hash.Hash{}, false)
+	if err != nil {
+		t.Fatalf("snapshot.New failed: %v", err)
+	}
+	state, err := NewStateDBWithSnapshot(db, hash.Hash{}, snaps)
+	if err != nil {
+		t.Fatalf("NewStateDBWithSnapshot failed: %v", err)
+	}
+	addr := types.Address{1}
+	state.AddBalance(addr, 100)
+	state.SetState(addr, hash.Hash{1}, hash.Hash{2})
+	state.SetState(addr, hash.Hash{3}, hash.Hash{4})
+	mustCommit(t, state)
+
+	// 删除后重新创建的账户不能从快照读到旧的存储
+	state.DeleteAccount(addr)
+	state.AddBalance(addr, 5)
+	if got := state.GetState(addr, hash.Hash{1}); got != (hash.Hash{}) {
+		t.Errorf("Expected wiped storage after recreation, got %x", got)
+	}
+	state.SetState(addr, hash.Hash{5}, hash.Hash{6})
+	state.IntermediateRoot()
+	if got := state.GetState(addr, hash.Hash{3}); got != (hash.Hash{}) {
+		t.Errorf("Expected wiped storage after IntermediateRoot, got %x", got)
+	}
+	root := mustCommit(t, state)
+	for _, key := range []hash.Hash{{1}, {3}} {
+		if got := state.GetState(addr, key); got != (hash.Hash{}) {
+			t.Errorf("Expected wiped storage after commit, got %x", got)
+		}
+	}
+	if got := state.GetState(addr, hash.Hash{5}); got != (hash.Hash{6}) {
+		t.Errorf("Expected new storage after commit, got %x", got)
+	}
+
+	reopened, err := NewStateDBWithSnapshot(db, root, snaps)
+	if err != nil {
+		t.Fatalf("NewStateDBWithSnapshot failed: %v", err)
+	}
+	if got := reopened.GetState(addr, hash.Hash{1}); got != (hash.Hash{}) {
+		t.Errorf("Expected wiped storage after reopening, got %x", got)
+	}
+	if got := reopened.GetState(addr, hash.Hash{5}); got != (hash.Hash{6}) {
+		t.Errorf("Expected new storage after reopening, got %x", got)
+	}
+
+	// 提交的存储树只包含新的存储，合并到磁盘后旧存储的快照也被删除
+	if err := snaps.Cap(root, 0); err != nil {
+		t.Fatalf("Cap failed: %v", err)
+	}
+	for _, key := range []hash.Hash{{1}, {3}} {
+		if _, err := rawdb.ReadStorageSnapshot(db, addr, key); !errors.Is(err, kvstore.ErrNotFound) {
+			t.Errorf("Expected snapshot of old slot %x to be dropped, got %v", key, err)
+		}
+	}
+	reopened, err = NewStateDB(db, root)
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	trie, err := openTrie(db, reopened.Load(addr).Root)
+	if err != nil {
+		t.Fatalf("openTrie failed: %v", err)
+	}
+	var slots []hash.Hash
+	trie.Iterate(func(key, value []byte) error {
+		slots = append(slots, hash.BytesToHash(key))
+		return nil
+	})
+	if len(slots) != 1 || slots[0] != (hash.Hash{5}) {
+		t.Errorf("Expected only the new slot in the committed storage trie, got %x", slots)
+	}
+	snaps, err = snapshot.New(db, root, false)
+	if err != nil {
+		t.Fatalf("snapshot.New failed: %v", err)
+	}
+	reopened, err = NewStateDBWithSnapshot(db, root, snaps)
+	if err != nil {
+		t.Fatalf("NewStateDBWithSnapshot failed: %v", err)
+	}
+	for key, want := range map[hash.Hash]hash.Hash{{1}: {}, {3}: {}, {5}: {6}} {
+		if got := reopened.GetState(addr, key); got != want {
+			t.Errorf("GetState(%x) after restart: want %x, got %x", key, want, got)
+		}
+	}
+}
+
+func TestStateDBWithSnapshot(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	snaps, err := snapshot.New(db, hash.Hash{}, false)
+	if err != nil {
+		t.Fatalf("snapshot.New failed: %v", err)
+	}
+	state, err := NewStateDBWithSnapshot(db, hash.Hash{}, snaps)
+	if err != nil {
+		t.Fatalf("NewStateDBWithSnapshot failed: %v", err)
+	}
+	addr := types.Address{1}
+	state.AddBalance(addr, 100)
+	state.SetState(addr, hash.Hash{1}, hash.Hash{2})
+	root1 := mustCommit(t, state)
+
+	state.Store(addr, nil)
+	state.AddBalance(addr, 5)
+	root2 := mustCommit(t, state)
+
+	snap := snaps.Snapshot(root2)
+	if snap == nil {
+		t.Fatalf("Expected snapshot for committed root")
+	}
+	if acc, err := snap.Account(addr); err != nil || acc.Amount != 5 {
+		t.Errorf("Snapshot account: got %+v, %v", acc, err)
+	}
+	if value, err := snap.Storage(addr, hash.Hash{1}); err != nil || value != (hash.Hash{}) {
+		t.Errorf("Expected storage of recreated account to be empty, got %x, %v", value, err)
+	}
+
+	state, err = NewStateDBWithSnapshot(db, root1, snaps)
+	if err != nil {
+		t.Fatalf("NewStateDBWithSnapshot at root1 failed: %v", err)
+	}
+	if got := state.GetState(addr, hash.Hash{1}); got != (hash.Hash{2}) {
+		t.Errorf("GetState through snapshot: got %x", got)
+	}
+	if acc := state.Load(addr); acc.Amount != 100 {
+		t.Errorf("Load through snapshot: got %+v", acc)
+	}
+}
+
+func TestDump(t *testing.T) {
+	db := memorydb.NewMemoryDB()
+	state, err := NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	for i := byte(1); i <= 3; i++ {
+		state.AddBalance(types.Address{i}, uint64(i)*100)
+	}
+	state.SetState(types.Address{2}, hash.Hash{1}, hash.Hash{9})
+	root := mustCommit(t, state)
+
+	var total uint64
+	var addrs []types.Address
+	for account, err := range IterateAccounts(db, root, DumpConfig{Storage: true}) {
+		if err != nil {
+			t.Fatalf("IterateAccounts failed: %v", err)
+		}
+		total += account.Balance
+		addrs = append(addrs, account.Address)
+		if account.Address == (types.Address{2}) && account.Storage[hash.Hash{1}] != (hash.Hash{9}) {
+			t.Errorf("Unexpected storage %v", account.Storage)
+		}
+	}
+	if total != 600 || len(addrs) != 3 || addrs[0] != (types.Address{1}) || addrs[2] != (types.Address{3}) {
+		t.Errorf("Unexpected accounts %x with total %d", addrs, total)
+	}
+
+	// 提前结束遍历
+	count := 0
+	for range IterateAccounts(db, root, DumpConfig{}) {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("Expected to stop after 1 account, got %d", count)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(db, root, DumpConfig{}, &buf); err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(lines))
+	}
+	var first DumpAccount
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatalf("Invalid JSON line %s: %v", lines[0], err)
+	}
+	if first.Address != (types.Address{1}) || first.Balance != 100 {
+		t.Errorf("Unexpected first account %+v", first)
+	}
+}
@@ -1,9 +1,9 @@
 package txpool
 
 import (
-	"hash"
 	"hyblockchain/statdb"
 	"hyblockchain/types"
+	"hyblockchain/utils/hash"
 	"sort"
 )
 
@@ -78,6 +78,21 @@ type DefaultPool struct {
 	txs      pendingTxs
 	Pendings map[types.Address][]SortedTxs
 	Queued   map[types.Address][]*types.Transaction
+
+	prefetcher *statdb.Prefetcher
+}
+
+// UsePrefetcher 设置预取器，交易进入 pending 时在后台预读其涉及的状态，
+// 传入 nil 取消预取
+func (pool *DefaultPool) UsePrefetcher(p *statdb.Prefetcher) {
+	pool.prefetcher = p
+}
+
+// prefetch 为即将执行的交易预读状态
+func (pool DefaultPool) prefetch(tx *types.Transaction) {
+	if pool.prefetcher != nil {
+		pool.prefetcher.PrefetchTx(tx.From(), tx)
+	}
 }
 
 func (pool *DefaultPool) NewTx(tx *types.Transaction) {
@@ -95,8 +110,10 @@ func (pool *DefaultPool) NewTx(tx *types.Transaction) {
 		pool.addQueue(tx)
 	} else if tx.Nonce() == expectedNonce {
 		pool.pushpending(blks, tx)
+		pool.prefetch(tx)
 	} else {
 		pool.replacePending(blks, tx)
+		pool.prefetch(tx)
 	}
 }
 
@@ -250,17 +267,22 @@ func (pool *DefaultPool) promoteQueued(addr types.Address) {
 
 	for _, tx := range promoteTxs {
 		blk.Push(tx)
+		pool.prefetch(tx)
 	}
 
 	sort.Sort(pool.txs)
 }
 
+// SetStatRoot 切换状态根，基于其他状态根的预取器不再使用
 func (pool *DefaultPool) SetStatRoot(root hash.Hash) {
 	pool.StatDB.SetRoot(root)
+	if pool.prefetcher != nil && pool.prefetcher.Root() != root {
+		pool.prefetcher = nil
+	}
 }
 
 // NewDefaultPool 创建一个默认的交易池
-func NewDefaultPool(stat *statdb.MockStatDB) *DefaultPool {
+func NewDefaultPool(stat statdb.StatDB) *DefaultPool {
 	return &DefaultPool{
 		StatDB:   stat,
 		all:      make(map[hash.Hash]bool),
@@ -3,11 +3,16 @@ package txpool
 import (
 	"fmt"
 	"sort"
+	"sync/atomic"
 	"testing"
 
 	"hyblockchain/crypto/secp256k1"
+	"hyblockchain/kvstore"
+	"hyblockchain/kvstore/cachedb"
+	"hyblockchain/kvstore/memorydb"
 	"hyblockchain/statdb"
 	"hyblockchain/types"
+	"hyblockchain/utils/hash"
 )
 
 // 格式化地址为 hex 字符串
@@ -118,3 +123,71 @@ func TestTxPoolAdvancedMoreCases(t *testing.T) {
 		t.Log("Pop on empty pool correctly returns nil")
 	}
 }
+
+// countingStore 统计对底层数据库的读取次数
+type countingStore struct {
+	kvstore.KVStore
+	reads atomic.Int64
+}
+
+func (c *countingStore) Get(key []byte) ([]byte, error) {
+	c.reads.Add(1)
+	return c.KVStore.Get(key)
+}
+
+func TestTxPoolPrefetch(t *testing.T) {
+	priv, _ := secp256k1.GenerateKey()
+	to := types.Address{1}
+	tx1, _ := types.NewTransactionWithSigner(to, 1, 21000, 1, 1, priv)
+	tx2, _ := types.NewTransactionWithSigner(to, 2, 21000, 1, 1, priv)
+	tx3, _ := types.NewTransactionWithSigner(to, 3, 21000, 1, 1, priv)
+	from := tx1.From()
+
+	db := memorydb.NewMemoryDB()
+	state, err := statdb.NewStateDB(db, hash.Hash{})
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	state.AddBalance(from, 100)
+	state.AddBalance(to, 1)
+	root, err := state.Commit()
+	if err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	store := &countingStore{KVStore: db}
+	cache := cachedb.NewCacheDB(store, 1<<20)
+	p := statdb.NewPrefetcher(cache, root, 2)
+	defer p.Close()
+
+	mock := statdb.NewMockStatDB()
+	mock.Store(from, &types.Account{})
+	pool := NewDefaultPool(mock)
+	pool.UsePrefetcher(p)
+	pool.NewTx(tx1)
+	pool.NewTx(tx3) // nonce 不连续，进入 queued，不预取
+	p.Wait()
+
+	// 执行 pending 交易时读取的状态已经在缓存中
+	store.reads.Store(0)
+	exec, err := statdb.NewStateDB(cache, root)
+	if err != nil {
+		t.Fatalf("NewStateDB failed: %v", err)
+	}
+	if acc := exec.Load(from); acc.Amount != 100 {
+		t.Errorf("Unexpected sender %+v", acc)
+	}
+	if acc := exec.Load(to); acc.Amount != 1 {
+		t.Errorf("Unexpected recipient %+v", acc)
+	}
+	if n := store.reads.Load(); n != 0 {
+		t.Errorf("Expected pending transaction state in cache, got %d database reads", n)
+	}
+
+	// 切换到其他状态根后不再使用旧的预取器
+	pool.SetStatRoot(hash.Hash{1})
+	pool.NewTx(tx2)
+	if pool.prefetcher != nil {
+		t.Errorf("Expected prefetcher for another root to be dropped")
+	}
+}
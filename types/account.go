@@ -1,6 +1,6 @@
 package types
 
-import "hash"
+import "hyblockchain/utils/hash"
 
 type Account struct {
 	Amount uint64
@@ -1,6 +1,9 @@
 package types
 
-import "hyblockchain/crypto/sha3"
+import (
+	"hyblockchain/crypto/sha3"
+	"hyblockchain/utils/hexutil"
+)
 
 type Address [20]byte
 
@@ -15,3 +18,13 @@ func PubKeyToAddress(pub []byte) Address {
 	copy(addr[:], hash[12:]) // 取最后20字节（160位）
 	return addr
 }
+
+// MarshalText 返回地址的十六进制表示
+func (a Address) MarshalText() ([]byte, error) {
+	return hexutil.Bytes(a[:]).MarshalText()
+}
+
+// UnmarshalText 解析十六进制表示的地址
+func (a *Address) UnmarshalText(input []byte) error {
+	return hexutil.UnmarshalFixedText("Address", input, a[:])
+}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"fmt"
+	"hyblockchain/crypto/sha3"
+	"hyblockchain/utils/hash"
+	"hyblockchain/utils/rlp"
+)
+
+// Header 是区块头
+type Header struct {
+	ParentHash hash.Hash
+	Height     uint64
+	Coinbase   Address
+	Root       hash.Hash // 执行完本区块后的状态根
+	TxRoot     hash.Hash
+	Timestamp  uint64
+}
+
+// Hash 返回区块头 RLP 编码的 Keccak256 哈希，即区块哈希
+func (h *Header) Hash() hash.Hash {
+	enc, err := rlp.EncodeToBytes(h)
+	if err != nil {
+		panic(fmt.Errorf("RLP encoding failed: %v", err))
+	}
+	return sha3.Keccak256(enc)
+}
+
+// Body 是区块体，保存区块中的交易
+type Body struct {
+	Transactions []*Transaction
+}
+
+// Block 由区块头和区块体组成
+type Block struct {
+	Header *Header
+	Body   *Body
+}
+
+// Hash 返回区块哈希
+func (b *Block) Hash() hash.Hash {
+	return b.Header.Hash()
+}
+
+// Height 返回区块高度
+func (b *Block) Height() uint64 {
+	return b.Header.Height
+}
@@ -0,0 +1,15 @@
+package types
+
+import "hyblockchain/utils/hash"
+
+const (
+	ReceiptStatusFailed     = uint64(0)
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// Receipt 记录一笔交易的执行结果
+type Receipt struct {
+	TxHash  hash.Hash
+	Status  uint64
+	GasUsed uint64
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"hyblockchain/crypto/secp256k1"
 	"hyblockchain/crypto/sha3"
+	"hyblockchain/utils/hash"
 	"hyblockchain/utils/hexutil"
 	"hyblockchain/utils/rlp"
+	"io"
 	"math/big"
 )
 
@@ -28,6 +30,39 @@ type signature struct {
 	V    uint8
 }
 
+// txRLP 是交易的 RLP 编码格式，txdata 和 signature 都是未导出的嵌入字段，
+// 需要显式列出才能被编码
+type txRLP struct {
+	Data txdata
+	R, S *big.Int
+	V    uint8
+}
+
+// EncodeRLP 实现 rlp.Encoder 接口
+func (tx *Transaction) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, &txRLP{Data: tx.txdata, R: tx.R, S: tx.S, V: tx.V})
+}
+
+// DecodeRLP 实现 rlp.Decoder 接口
+func (tx *Transaction) DecodeRLP(s *rlp.Stream) error {
+	var dec txRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	tx.txdata = dec.Data
+	tx.signature = signature{R: dec.R, S: dec.S, V: dec.V}
+	return nil
+}
+
+// Hash 返回交易 RLP 编码的 Keccak256 哈希
+func (tx *Transaction) Hash() hash.Hash {
+	enc, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		panic(fmt.Errorf("RLP encoding failed: %v", err))
+	}
+	return sha3.Keccak256(enc)
+}
+
 func (tx Transaction) GasPrice() uint64 {
 	return tx.txdata.GasPrice
 }